@@ -0,0 +1,107 @@
+// Copyright 2013 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package layouts
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DefaultUndatedLabel is the label of archive group with undated pages.
+const DefaultUndatedLabel = "Undated"
+
+// ArchiveYear is a group of pages published in a year.
+type ArchiveYear struct {
+	Year   int // zero for undated pages
+	Label  string
+	Months []*ArchiveMonth
+}
+
+// ArchiveMonth is a group of pages published in a month.
+type ArchiveMonth struct {
+	Month time.Month // zero for undated pages
+	Posts []interface{}
+}
+
+// SetUndatedLabel sets label of archive group with undated pages.
+func (c *Collection) SetUndatedLabel(label string) {
+	c.undatedLabel = label
+}
+
+// listOf returns elements of the given slice.
+func listOf(list interface{}) ([]interface{}, error) {
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("%T is not a list", list)
+	}
+	out := make([]interface{}, v.Len())
+	for i := range out {
+		out[i] = v.Index(i).Interface()
+	}
+	return out, nil
+}
+
+type datedPage struct {
+	date time.Time
+	page interface{}
+}
+
+type byDateDesc []datedPage
+
+func (d byDateDesc) Len() int           { return len(d) }
+func (d byDateDesc) Less(i, j int) bool { return d[i].date.After(d[j].date) }
+func (d byDateDesc) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+// archive groups pages by year and month of their dates,
+// most recent first. Undated pages are put into the last group.
+func (c *Collection) archive(posts interface{}) ([]*ArchiveYear, error) {
+	list, err := listOf(posts)
+	if err != nil {
+		return nil, err
+	}
+	var dated []datedPage
+	var undated []interface{}
+	for _, p := range list {
+		meta, err := metaOf(p)
+		if err != nil {
+			return nil, err
+		}
+		date, ok, err := metaDate(meta, "date")
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			undated = append(undated, p)
+			continue
+		}
+		dated = append(dated, datedPage{date, p})
+	}
+	sort.Stable(byDateDesc(dated))
+	var years []*ArchiveYear
+	for _, d := range dated {
+		if len(years) == 0 || years[len(years)-1].Year != d.date.Year() {
+			years = append(years, &ArchiveYear{
+				Year:  d.date.Year(),
+				Label: strconv.Itoa(d.date.Year()),
+			})
+		}
+		y := years[len(years)-1]
+		if len(y.Months) == 0 || y.Months[len(y.Months)-1].Month != d.date.Month() {
+			y.Months = append(y.Months, &ArchiveMonth{Month: d.date.Month()})
+		}
+		m := y.Months[len(y.Months)-1]
+		m.Posts = append(m.Posts, d.page)
+	}
+	if len(undated) > 0 {
+		years = append(years, &ArchiveYear{
+			Label:  c.undatedLabel,
+			Months: []*ArchiveMonth{{Posts: undated}},
+		})
+	}
+	return years, nil
+}
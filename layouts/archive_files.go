@@ -0,0 +1,95 @@
+// Copyright 2013 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package layouts
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/dchest/kkr/metafile"
+)
+
+// addFromReader adds layout read from r. Like in AddDir,
+// files with any path element starting with a dot are skipped.
+func (c *Collection) addFromReader(name string, r io.Reader, fi os.FileInfo) error {
+	if isHiddenPath(name) {
+		c.warn(SkippedWarning, name, "skipped dotfile")
+		return nil
+	}
+	f, err := metafile.NewReader(r, fi)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	l, err := c.newLayoutFromMetafile(name, f, true)
+	if err != nil {
+		return err
+	}
+	c.checkDeprecated(l.Template, name)
+	c.layouts[l.Name] = l
+	c.resetSourceHash()
+	log.Printf("L %s", l.Name)
+	return nil
+}
+
+// isHiddenPath reports whether any element of slash-separated
+// archive path starts with a dot.
+func isHiddenPath(name string) bool {
+	for _, s := range strings.Split(name, "/") {
+		if strings.HasPrefix(s, ".") && s != "." && s != ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// AddArchive adds layouts from files in zip archive.
+func (c *Collection) AddArchive(r io.ReaderAt, size int64) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	for _, zf := range zr.File {
+		fi := zf.FileInfo()
+		if fi.IsDir() {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return err
+		}
+		err = c.addFromReader(zf.Name, rc, fi)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddTar adds layouts from files in tar archive.
+func (c *Collection) AddTar(r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fi := hdr.FileInfo()
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+		if err := c.addFromReader(hdr.Name, tr, fi); err != nil {
+			return err
+		}
+	}
+}
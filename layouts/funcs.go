@@ -0,0 +1,1544 @@
+// Copyright 2013 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package layouts
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dchest/kkr/utils"
+)
+
+// builtinFuncs returns template functions provided by collection.
+// Functions provided by site context override them. Functions which
+// depend on the page being rendered use the given render state, which
+// can be nil outside of rendering.
+func (c *Collection) builtinFuncs(st *renderState) FuncMap {
+	return FuncMap{
+		// `now` returns current time.
+		"now": func() time.Time {
+			return c.now()
+		},
+		// `year`, `month`, `day` return parts of current date.
+		"year": func() int {
+			return c.now().Year()
+		},
+		"month": func() int {
+			return int(c.now().Month())
+		},
+		"day": func() int {
+			return c.now().Day()
+		},
+		// `between` returns true if current time is within the given
+		// dates: not before start and before end. End date without time
+		// includes the whole day. Empty date is ignored.
+		"between": c.between,
+		// `localizeDate` formats time using names from the given locale.
+		// Only a few built-in locales are supported, see locales.
+		"localizeDate": c.localizeDate,
+		// `localizeNumber` formats number using separators from the given locale.
+		"localizeNumber": c.localizeNumber,
+		// `T` returns translated message for key.
+		"T": func(key string, args ...interface{}) (string, error) {
+			return c.translate(st, key, args...)
+		},
+		// `hreflangs` returns alternate links to translations of page.
+		"hreflangs": c.hreflangs,
+		// `renderPageByURL` returns rendered content of page with the given URL.
+		"renderPageByURL": func(url string) (string, error) {
+			return c.renderPageByURL(st, url)
+		},
+		// `cleanContent` strips BOM, normalizes newlines and
+		// removes trailing whitespace from lines.
+		"cleanContent": cleanContent,
+		// `jsonld` returns script block with JSON-LD structured data.
+		"jsonld": jsonld,
+		// `permalink` returns page URL made from permalink pattern.
+		"permalink": c.permalink,
+		// `tmpl` executes template string with the given data.
+		"tmpl": func(s string, data interface{}) (string, error) {
+			return c.tmpl(st, s, data)
+		},
+		// `contrastColor` returns black or white color,
+		// whichever is more readable on the given background.
+		"contrastColor": contrastColor,
+		// `absURL` prepends site URL to paths starting with a slash.
+		"absURL": c.absURL,
+		// `isValidURL` reports whether string is an absolute HTTP(S) URL.
+		"isValidURL": isValidURL,
+		// `normalizeURL` returns normalized URL.
+		"normalizeURL": normalizeURL,
+		// `toc` returns table of contents for headings with ids in HTML content.
+		// Optional arguments are minimum and maximum heading levels and
+		// whether the list should be ordered, e.g. {{toc .Content 2 3 true}}.
+		"toc": toc,
+		// `lengthClass` returns "short", "medium", or "long"
+		// depending on the number of words in content.
+		"lengthClass": c.lengthClass,
+		// `sanitize` sanitizes untrusted HTML.
+		"sanitize": c.sanitize,
+		// `archive` groups pages by year and month.
+		"archive": c.archive,
+		// `linkify` wraps bare URLs in text into links.
+		"linkify": linkify,
+		// `colorFrom` returns color derived from string.
+		"colorFrom": c.colorFrom,
+		// `container` wraps content into container element.
+		"container": func(content string, opts ...map[string]interface{}) (string, error) {
+			return c.wrapContainer(st, content, opts...)
+		},
+		// `prevInTaxonomy` and `nextInTaxonomy` return adjacent pages
+		// with the same taxonomy value, such as category.
+		"prevInTaxonomy": prevInTaxonomy,
+		"nextInTaxonomy": nextInTaxonomy,
+		// `resourceHint` returns link element with resource hint,
+		// e.g. {{resourceHint "preload" "/fonts/x.woff2" "font"}}.
+		"resourceHint": resourceHint,
+		// `humanizeDuration` returns compact human-readable duration,
+		// such as "1h 23m", given time.Duration or number of seconds.
+		"humanizeDuration": humanizeDuration,
+		// `dict` returns map made from the given key-value pairs.
+		"dict": dict,
+		// `classnames` joins class names from strings and from keys
+		// of maps with true values, e.g. {{classnames "btn" (dict "active" .Page.active)}}.
+		"classnames": classnames,
+		// `readingMeta` returns word count and estimated reading time.
+		"readingMeta": func(content string) (*ReadingMeta, error) {
+			return c.readingMeta(st, content)
+		},
+		// `summaryOf` returns page summary: content before <!--more-->
+		// or the first words of content.
+		"summaryOf": func(page interface{}) (string, error) {
+			return c.summaryOf(st, page)
+		},
+		// `feedLink`, `rssLink`, and `atomLink` return feed autodiscovery links.
+		"feedLink": c.feedLink,
+		"rssLink": func(title, url string) string {
+			return c.feedLink(title, url, "application/rss+xml")
+		},
+		"atomLink": func(title, url string) string {
+			return c.feedLink(title, url, "application/atom+xml")
+		},
+		// `kvtable` returns HTML table of sorted keys and values of map.
+		"kvtable": c.kvtable,
+		// `percent` returns part of whole as percentage, such as "42%",
+		// with the optional number of decimal places.
+		"percent": c.percent,
+		// `ratio` returns a divided by b.
+		"ratio": c.ratio,
+		// `anchorize` returns anchor name made from text.
+		"anchorize": anchorize,
+		// `vcs` returns version control information set with SetVCSInfo.
+		"vcs": c.VCS,
+		// `consentScript` returns script element if its consent category
+		// is allowed, or inactive placeholder, which consent manager
+		// can activate, otherwise.
+		"consentScript": c.consentScript,
+		// `includeFrom` executes include from the linked collection
+		// with the optional data, e.g. {{includeFrom "web" "footer" .}}.
+		"includeFrom": func(collection, name string, data ...interface{}) (string, error) {
+			return c.includeFrom(st, collection, name, data...)
+		},
+		// `placeholder` returns skeleton include for lazy
+		// content set with SetPlaceholder, e.g. {{placeholder "card"}}.
+		"placeholder": func(name string) (string, error) {
+			return c.placeholder(st, name)
+		},
+		// `urlDepth` returns the number of path segments in URL.
+		"urlDepth": urlDepth,
+		// `datauri` returns data URI with base64-encoded contents of
+		// small file, e.g. {{datauri "/img/icon.png"}}. Files are read
+		// from directory set with SetDataURIRoot.
+		"datauri": c.datauri,
+		// `menuTree` builds menu tree from flat list of items
+		// with `id`, `parent`, and `weight` keys.
+		"menuTree": menuTree,
+		// `sortedKeys` returns keys of map converted to strings in sorted order.
+		"sortedKeys": sortedKeys,
+		// `rangeSorted` returns key-value pairs of map sorted by key,
+		// e.g. {{range rangeSorted .Page.links}}{{.Key}}: {{.Value}}{{end}}.
+		"rangeSorted": rangeSorted,
+		// `outputPath` returns path of output file for URL.
+		"outputPath": c.OutputPath,
+		// `checklink` returns internal URL if it's known or reports it.
+		"checklink": func(link string) (string, error) {
+			return c.checklink(st, link)
+		},
+		// `jsonfeed` returns JSON Feed made from site and posts,
+		// e.g. {{jsonfeed .Site .Site.Posts}}.
+		"jsonfeed": c.jsonfeed,
+		// `default` returns value if it's not empty, otherwise def,
+		// e.g. {{.Page.image | default "/img/default.png"}}.
+		"default": defaultValue,
+		// `coalesce` returns the first non-empty value.
+		"coalesce": coalesce,
+		// `safeRange` returns list, or empty list if it's nil or not
+		// a list or map, e.g. {{range safeRange .Page.links}}.
+		"safeRange": safeRange,
+		// `safeIndex` is like `index`, but returns nil
+		// instead of error for nil values and missing keys.
+		"safeIndex": safeIndex,
+		// `sample` returns n items of list shuffled with collection seed
+		// combined with the optional seed string, e.g. {{sample .Site.Posts 3 "featured"}}.
+		"sample": c.sample,
+		// `pageID` returns stable id of page made from its source path.
+		"pageID": pageID,
+		// `diffHighlight` returns HTML with lines
+		// of unified diff marked with classes.
+		"diffHighlight": diffHighlight,
+		// `wrap` word-wraps text to the given width, keeping paragraphs.
+		"wrap": wrap,
+		// `qr` returns data URI with PNG image of QR code for URL.
+		"qr": c.qr,
+		// `seriesNav` returns ordered parts of page's series and position
+		// of page among them, e.g. "Part {{.Number}} of {{.Total}}".
+		"seriesNav": seriesNav,
+		// `semverCompare` returns -1, 0, or 1 depending on whether
+		// version a is lower, equal, or higher than b.
+		"semverCompare": c.semverCompare,
+		// `semverSort` returns versions sorted from the highest.
+		"semverSort": c.semverSort,
+		// `semverLatest` returns the highest version.
+		"semverLatest": c.semverLatest,
+		// `outputLinks` returns links to outputs of page listed in
+		// its `outputs` meta, e.g. {{range outputLinks .Page}}...{{end}}.
+		"outputLinks": c.outputLinks,
+		// `firstParagraph` returns the first paragraph of content.
+		"firstParagraph": firstParagraph,
+		// `chromeMeta` returns theme color meta, favicon, and manifest
+		// links from configuration set with SetChromeConfig or from
+		// site `theme_color`, `favicon`, `apple_touch_icon`, and
+		// `manifest` values.
+		"chromeMeta": c.chromeMeta,
+		// `buildID` returns build identifier.
+		"buildID": c.BuildID,
+		// `jsEscape` escapes string for use inside JavaScript string literal
+		// in HTML, including </script>, and U+2028 and U+2029 separators.
+		"jsEscape": jsEscape,
+		// `lastUpdated` returns "Last updated on <date>" line, translated
+		// with LastUpdatedKey message, with page's `lastmod` or `date`,
+		// or nothing.
+		"lastUpdated": func(page interface{}) (string, error) {
+			return c.lastUpdated(st, page)
+		},
+		// `include` function returns text from include file.
+		"include": func(name string) (string, error) {
+			return c.include(st, name)
+		},
+	}
+}
+
+// findInclude returns include by name from this collection
+// or from the chain of its fallback collections.
+func (c *Collection) findInclude(name string) (string, bool) {
+	seen := make(map[*Collection]bool)
+	for x := c; x != nil && !seen[x]; x = x.fallback {
+		if out, ok := x.includes[name]; ok {
+			return out, true
+		}
+		seen[x] = true
+	}
+	return "", false
+}
+
+func (c *Collection) include(st *renderState, name string) (string, error) {
+	if st != nil && st.includes != nil {
+		st.includes[name] = true
+	}
+	out, ok := c.findInclude(name)
+	if !ok {
+		if c.devMode && c.missingPartialComment {
+			return fmt.Sprintf("<!-- missing partial: %s -->", name), nil
+		}
+		return "", fmt.Errorf("include %q not found", name)
+	}
+	return out, nil
+}
+
+// pageURL returns URL of page, which can be given as a URL string,
+// page meta, or PageContext.
+func pageURL(page interface{}) (string, error) {
+	switch p := page.(type) {
+	case string:
+		return p, nil
+	case PageContext:
+		return p.URL(), nil
+	case map[string]interface{}:
+		if u, ok := p["url"].(string); ok {
+			return u, nil
+		}
+		return "", fmt.Errorf("page has no url")
+	default:
+		return "", fmt.Errorf("cannot get url of %T", page)
+	}
+}
+
+// absURL prepends site URL to url if it starts with a slash.
+func (c *Collection) absURL(url string) string {
+	if strings.HasPrefix(url, "/") && !strings.HasPrefix(url, "//") {
+		return c.baseURL + url
+	}
+	return url
+}
+
+func (c *Collection) hreflangs(page interface{}) (string, error) {
+	if c.translationsMap == nil {
+		return "", nil
+	}
+	url, err := pageURL(page)
+	if err != nil {
+		return "", err
+	}
+	m := c.translationsMap(url)
+	langs := make([]string, 0, len(m))
+	for lang := range m {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	var buf bytes.Buffer
+	for i, lang := range langs {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		fmt.Fprintf(&buf, `<link rel="alternate" hreflang="%s" href="%s">`,
+			template.HTMLEscapeString(lang), template.HTMLEscapeString(c.absURL(m[lang])))
+	}
+	return buf.String(), nil
+}
+
+func (c *Collection) renderPageByURL(st *renderState, url string) (string, error) {
+	if c.pageResolver == nil {
+		return "", fmt.Errorf("renderPageByURL: no page resolver")
+	}
+	if st.rendering(url) {
+		return "", fmt.Errorf("renderPageByURL: page %q includes itself", url)
+	}
+	p, err := c.pageResolver(url)
+	if err != nil {
+		return "", err
+	}
+	return c.renderContent(st, p)
+}
+
+func cleanContent(s string) string {
+	s = strings.TrimPrefix(s, "\ufeff")
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	s = strings.Replace(s, "\r", "\n", -1)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func jsonld(data interface{}) (string, error) {
+	// Marshal escapes <, >, and & so that the result
+	// is safe to put inside a script element.
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	return `<script type="application/ld+json">` + string(b) + `</script>`, nil
+}
+
+// metaOf returns meta of page, which can be
+// given as page meta or PageContext.
+func metaOf(page interface{}) (map[string]interface{}, error) {
+	switch p := page.(type) {
+	case map[string]interface{}:
+		return p, nil
+	case PageContext:
+		return p.Meta(), nil
+	default:
+		return nil, fmt.Errorf("cannot get meta of %T", page)
+	}
+}
+
+// pageOf returns page, which can be given as PageContext or as page
+// meta. Page is found by `url` from meta: it's either the page being
+// rendered with the given state, or page returned by page resolver.
+func (c *Collection) pageOf(st *renderState, page interface{}) (PageContext, error) {
+	if p, ok := page.(PageContext); ok {
+		return p, nil
+	}
+	meta, err := metaOf(page)
+	if err != nil {
+		return nil, err
+	}
+	url, _ := meta["url"].(string)
+	if url == "" {
+		return nil, fmt.Errorf("page has no url")
+	}
+	if st != nil && st.page != nil && st.page.URL() == url {
+		return st.page, nil
+	}
+	if c.pageResolver == nil {
+		return nil, fmt.Errorf("no page resolver to find page %q", url)
+	}
+	return c.pageResolver(url)
+}
+
+// metaDate returns date from page meta.
+func metaDate(meta map[string]interface{}, key string) (time.Time, bool, error) {
+	switch d := meta[key].(type) {
+	case nil:
+		return time.Time{}, false, nil
+	case time.Time:
+		return d, true, nil
+	case string:
+		t, err := utils.ParseAnyDate(d)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		return t, true, nil
+	default:
+		return time.Time{}, false, fmt.Errorf("`%s` is not a date", key)
+	}
+}
+
+func (c *Collection) between(start, end interface{}) (bool, error) {
+	now := c.now()
+	s, ok, err := dateArg(start, "start")
+	if err != nil {
+		return false, fmt.Errorf("between: %s", err)
+	}
+	if ok && now.Before(s) {
+		return false, nil
+	}
+	e, ok, err := dateArg(end, "end")
+	if err != nil {
+		return false, fmt.Errorf("between: %s", err)
+	}
+	if s, isString := end.(string); ok && isString && isDateOnly(s) {
+		// Include the whole end day.
+		e = e.AddDate(0, 0, 1)
+	}
+	if ok && !now.Before(e) {
+		return false, nil
+	}
+	return true, nil
+}
+
+// dateArg returns date from template function argument
+// like metaDate, treating empty string as no date.
+func dateArg(v interface{}, name string) (time.Time, bool, error) {
+	if s, ok := v.(string); ok && s == "" {
+		return time.Time{}, false, nil
+	}
+	return metaDate(map[string]interface{}{name: v}, name)
+}
+
+// isDateOnly reports whether s is a date without time,
+// such as "2006-01-02" or "2006.01.02".
+func isDateOnly(s string) bool {
+	for _, layout := range []string{"2006-01-02", "2006.01.02"} {
+		if _, err := time.Parse(layout, s); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// slugify returns lowercase string with runs of
+// non-alphanumeric characters replaced with dashes.
+func slugify(s string) string {
+	var buf bytes.Buffer
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && buf.Len() > 0 {
+				buf.WriteByte('-')
+			}
+			buf.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return buf.String()
+}
+
+var permalinkPlaceholderRx = regexp.MustCompile(`:[a-z_]+`)
+
+func (c *Collection) permalink(page interface{}) (string, error) {
+	meta, err := metaOf(page)
+	if err != nil {
+		return "", err
+	}
+	date, hasDate, err := metaDate(meta, "date")
+	if err != nil {
+		return "", err
+	}
+	title, _ := meta["title"].(string)
+	values := map[string]string{
+		":title": slugify(title),
+		":slug":  slugify(title),
+	}
+	if slug, ok := meta["slug"].(string); ok {
+		values[":slug"] = slug
+	}
+	if hasDate {
+		values[":year"] = date.Format("2006")
+		values[":month"] = date.Format("01")
+		values[":day"] = date.Format("02")
+	}
+	switch cat := meta["category"].(type) {
+	case string:
+		values[":category"] = slugify(cat)
+	case []interface{}:
+		if len(cat) > 0 {
+			values[":category"] = slugify(fmt.Sprint(cat[0]))
+		}
+	}
+	err = nil
+	out := permalinkPlaceholderRx.ReplaceAllStringFunc(c.permalinkPattern, func(p string) string {
+		v, ok := values[p]
+		if !ok && err == nil {
+			err = fmt.Errorf("permalink: unknown or empty placeholder %s", p)
+		}
+		return v
+	})
+	if err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// maxTmplDepth is the maximum nesting of `tmpl` calls.
+const maxTmplDepth = 10
+
+func (c *Collection) tmpl(st *renderState, s string, data interface{}) (string, error) {
+	if st == nil {
+		st = &renderState{}
+	}
+	if st.tmplDepth >= maxTmplDepth {
+		return "", fmt.Errorf("tmpl: exceeded maximum nesting depth %d", maxTmplDepth)
+	}
+	c.mu.Lock()
+	t, ok := c.tmplCache[s]
+	c.mu.Unlock()
+	if !ok {
+		var err error
+		t, err = template.New("tmpl").Funcs(c.funcs(nil)).Parse(s)
+		if err != nil {
+			return "", err
+		}
+		c.mu.Lock()
+		c.tmplCache[s] = t
+		c.mu.Unlock()
+	}
+	// Nested calls get a copy of state with increased depth.
+	inner := *st
+	inner.tmplDepth++
+	t, err := c.bind(t, &inner)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (c *Collection) includeFrom(st *renderState, collection, name string, data ...interface{}) (string, error) {
+	if len(data) > 1 {
+		return "", fmt.Errorf("includeFrom: too many arguments")
+	}
+	other, ok := c.linked[collection]
+	if !ok {
+		return "", fmt.Errorf("includeFrom: collection %q not linked", collection)
+	}
+	text, ok := other.findInclude(name)
+	if !ok {
+		return "", fmt.Errorf("includeFrom: include %q not found in %q", name, collection)
+	}
+	// Guard against cycles, which can span collections.
+	if st == nil {
+		st = &renderState{}
+	}
+	active := activeInclude{other, name}
+	if st.active[active] {
+		return "", fmt.Errorf("includeFrom: include %q from %q includes itself", name, collection)
+	}
+	// Includes of other collection are not recorded as used by page.
+	inner := *st
+	inner.includes = nil
+	inner.active = make(map[activeInclude]bool, len(st.active)+1)
+	for k := range st.active {
+		inner.active[k] = true
+	}
+	inner.active[active] = true
+	var d interface{}
+	if len(data) > 0 {
+		d = data[0]
+	}
+	return other.tmpl(&inner, text, d)
+}
+
+func (c *Collection) placeholder(st *renderState, name string) (string, error) {
+	includeName, ok := c.placeholders[name]
+	if !ok {
+		return "", fmt.Errorf("placeholder %q not set", name)
+	}
+	return c.include(st, includeName)
+}
+
+func urlDepth(s string) (int, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, seg := range strings.Split(u.Path, "/") {
+		if seg != "" {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (c *Collection) datauri(name string) (string, error) {
+	if c.dataURIRoot == "" {
+		return "", fmt.Errorf("datauri: root directory not set")
+	}
+	// Cleaning rooted path removes all ".." elements.
+	filename := filepath.Join(c.dataURIRoot, filepath.FromSlash(path.Clean("/"+name)))
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return "", fmt.Errorf("datauri: %s", err)
+	}
+	if fi.Size() > c.dataURIMaxSize {
+		return "", fmt.Errorf("datauri: %q is larger than %d bytes", name, c.dataURIMaxSize)
+	}
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", fmt.Errorf("datauri: %s", err)
+	}
+	typ := mime.TypeByExtension(filepath.Ext(filename))
+	if typ == "" {
+		typ = "application/octet-stream"
+	}
+	return "data:" + typ + ";base64," + base64.StdEncoding.EncodeToString(b), nil
+}
+
+// KeyValue is a key-value pair of map.
+type KeyValue struct {
+	Key   string
+	Value interface{}
+}
+
+type byKey []KeyValue
+
+func (p byKey) Len() int           { return len(p) }
+func (p byKey) Less(i, j int) bool { return p[i].Key < p[j].Key }
+func (p byKey) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+func rangeSorted(m interface{}) ([]KeyValue, error) {
+	v := reflect.ValueOf(m)
+	if v.Kind() != reflect.Map {
+		return nil, fmt.Errorf("%T is not a map", m)
+	}
+	pairs := make([]KeyValue, 0, v.Len())
+	for _, k := range v.MapKeys() {
+		pairs = append(pairs, KeyValue{fmt.Sprint(k.Interface()), v.MapIndex(k).Interface()})
+	}
+	sort.Sort(byKey(pairs))
+	return pairs, nil
+}
+
+func sortedKeys(m interface{}) ([]string, error) {
+	pairs, err := rangeSorted(m)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, len(pairs))
+	for i, p := range pairs {
+		keys[i] = p.Key
+	}
+	return keys, nil
+}
+
+// SetKnownURLs sets URLs of site pages used by `checklink` template
+// function to validate internal links. If strict is true, unknown links
+// cause rendering errors, otherwise they are reported as warnings.
+func (c *Collection) SetKnownURLs(urls []string, strict bool) {
+	c.knownURLs = make(map[string]bool, len(urls))
+	for _, u := range urls {
+		c.knownURLs[u] = true
+	}
+	c.strictLinks = strict
+}
+
+func (c *Collection) checklink(st *renderState, link string) (string, error) {
+	if c.knownURLs == nil {
+		return link, nil
+	}
+	p := link
+	if c.baseURL != "" && strings.HasPrefix(p, c.baseURL+"/") {
+		p = p[len(c.baseURL):]
+	}
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") {
+		return link, nil // external link
+	}
+	if i := strings.IndexAny(p, "?#"); i >= 0 {
+		p = p[:i]
+	}
+	if c.knownURLs[p] {
+		return link, nil
+	}
+	if c.strictLinks {
+		return "", fmt.Errorf("checklink: unknown URL %q", link)
+	}
+	source := ""
+	if st != nil && st.page != nil {
+		source = sourcePath(st.page)
+	}
+	c.warn(BrokenLinkWarning, source, "unknown URL %q", link)
+	return link, nil
+}
+
+// isEmpty reports whether value is empty: nil, false, zero number,
+// or empty string, slice, or map, like in `if` template action.
+func isEmpty(v interface{}) bool {
+	truth, ok := template.IsTrue(v)
+	return !ok || !truth
+}
+
+func defaultValue(def, value interface{}) interface{} {
+	if isEmpty(value) {
+		return def
+	}
+	return value
+}
+
+// coalesce returns the first non-empty value. If all values are empty,
+// it returns the last one, or nil if there are no values.
+func coalesce(values ...interface{}) interface{} {
+	for _, v := range values {
+		if !isEmpty(v) {
+			return v
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return values[len(values)-1]
+}
+
+func safeRange(v interface{}) interface{} {
+	if v != nil {
+		switch reflect.ValueOf(v).Kind() {
+		case reflect.Slice, reflect.Array, reflect.Map, reflect.Chan:
+			return v
+		}
+	}
+	return []interface{}{}
+}
+
+func safeIndex(item interface{}, indices ...interface{}) interface{} {
+	v := reflect.ValueOf(item)
+	for _, i := range indices {
+		for v.IsValid() && (v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr) {
+			if v.IsNil() {
+				return nil
+			}
+			v = v.Elem()
+		}
+		if !v.IsValid() {
+			return nil
+		}
+		switch v.Kind() {
+		case reflect.Slice, reflect.Array, reflect.String:
+			n, err := toFloat(i)
+			if err != nil || n < 0 || int(n) >= v.Len() {
+				return nil
+			}
+			v = v.Index(int(n))
+		case reflect.Map:
+			k := reflect.ValueOf(i)
+			if !k.IsValid() {
+				return nil
+			}
+			if !k.Type().AssignableTo(v.Type().Key()) {
+				if !k.Type().ConvertibleTo(v.Type().Key()) {
+					return nil
+				}
+				k = k.Convert(v.Type().Key())
+			}
+			v = v.MapIndex(k)
+		default:
+			return nil
+		}
+	}
+	if !v.IsValid() {
+		return nil
+	}
+	return v.Interface()
+}
+
+func (c *Collection) sample(list interface{}, n int, seed ...string) ([]interface{}, error) {
+	items, err := listOf(list)
+	if err != nil {
+		return nil, fmt.Errorf("sample: %s", err)
+	}
+	if len(seed) > 1 {
+		return nil, fmt.Errorf("sample: too many arguments")
+	}
+	s := c.seed
+	if len(seed) > 0 {
+		h := fnv.New64a()
+		h.Write([]byte(seed[0]))
+		s ^= int64(h.Sum64())
+	}
+	if n > len(items) {
+		n = len(items)
+	}
+	if n < 0 {
+		n = 0
+	}
+	r := rand.New(rand.NewSource(s))
+	for i := range items {
+		j := i + r.Intn(len(items)-i)
+		items[i], items[j] = items[j], items[i]
+	}
+	return items[:n], nil
+}
+
+// sourceID returns id made from hash of source path.
+func sourceID(source string) string {
+	h := sha256.Sum256([]byte(filepath.ToSlash(filepath.Clean(source))))
+	return hex.EncodeToString(h[:8])
+}
+
+// pageID returns id of page, which can be given as PageContext
+// or as page meta with `source_path` added when rendering.
+func pageID(page interface{}) (string, error) {
+	var source string
+	switch p := page.(type) {
+	case map[string]interface{}:
+		source, _ = p["source_path"].(string)
+	case PageContext:
+		source = sourcePath(p)
+	default:
+		return "", fmt.Errorf("pageID: %T is not a page", page)
+	}
+	if source == "" {
+		return "", fmt.Errorf("pageID: page has no source path")
+	}
+	return sourceID(source), nil
+}
+
+func diffHighlight(text string) string {
+	var buf bytes.Buffer
+	buf.WriteString(`<pre class="diff"><code>`)
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	inHunk := false // file headers are only before hunks
+	for i, line := range lines {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		class := ""
+		switch {
+		case strings.HasPrefix(line, "diff "):
+			inHunk = false // next file in git diff
+		case !inHunk && (strings.HasPrefix(line, "+++") || strings.HasPrefix(line, "---")):
+			class = "diff-file"
+		case strings.HasPrefix(line, "@@"):
+			class = "diff-hunk"
+			inHunk = true
+		case strings.HasPrefix(line, "+"):
+			class = "diff-add"
+		case strings.HasPrefix(line, "-"):
+			class = "diff-del"
+		}
+		line = template.HTMLEscapeString(line)
+		if class != "" {
+			line = `<span class="` + class + `">` + line + `</span>`
+		}
+		buf.WriteString(line)
+	}
+	buf.WriteString("</code></pre>")
+	return buf.String()
+}
+
+var paragraphRx = regexp.MustCompile(`\n[ \t]*\n\s*`)
+
+// wrap wraps words of each paragraph of text into lines of at most width
+// characters. Words longer than width are put on their own lines.
+func wrap(width int, s string) string {
+	paragraphs := paragraphRx.Split(strings.TrimSpace(s), -1)
+	for i, p := range paragraphs {
+		var lines []string
+		line := ""
+		for _, w := range strings.Fields(p) {
+			switch {
+			case line == "":
+				line = w
+			case utf8.RuneCountInString(line)+1+utf8.RuneCountInString(w) <= width:
+				line += " " + w
+			default:
+				lines = append(lines, line)
+				line = w
+			}
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+		paragraphs[i] = strings.Join(lines, "\n")
+	}
+	return strings.Join(paragraphs, "\n\n")
+}
+
+func (c *Collection) qr(url string) (string, error) {
+	if c.qrFunc == nil {
+		return "", fmt.Errorf("qr: QR code function not set")
+	}
+	b, err := c.qrFunc(c.absURL(url))
+	if err != nil {
+		return "", fmt.Errorf("qr: %s", err)
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(b), nil
+}
+
+var firstParagraphRx = regexp.MustCompile(`(?is)<p(?:\s[^>]*)?>(.*?)</p>`)
+
+// firstParagraph returns inner HTML of the first <p> element in content
+// or, for plain text, the first block delimited by blank lines, which
+// is not a Markdown heading.
+func firstParagraph(content string) string {
+	if m := firstParagraphRx.FindStringSubmatch(content); m != nil {
+		return strings.TrimSpace(m[1])
+	}
+	for _, block := range paragraphRx.Split(strings.TrimSpace(content), -1) {
+		lines := strings.Split(block, "\n")
+		if strings.HasPrefix(block, "#") {
+			// ATX heading, possibly followed by paragraph lines.
+			lines = lines[1:]
+		} else if len(lines) == 2 && strings.Trim(lines[1], "=-") == "" {
+			// Setext heading.
+			continue
+		}
+		if p := strings.TrimSpace(strings.Join(lines, "\n")); p != "" {
+			return p
+		}
+	}
+	return ""
+}
+
+func (c *Collection) chromeMeta(site interface{}) string {
+	get := func(value, key string) string {
+		if value != "" {
+			return value
+		}
+		return siteField(site, key)
+	}
+	var buf bytes.Buffer
+	if v := get(c.chrome.ThemeColor, "theme_color"); v != "" {
+		fmt.Fprintf(&buf, `<meta name="theme-color" content="%s">`+"\n", template.HTMLEscapeString(v))
+	}
+	if v := get(c.chrome.Favicon, "favicon"); v != "" {
+		fmt.Fprintf(&buf, `<link rel="icon" href="%s">`+"\n", template.HTMLEscapeString(c.absURL(v)))
+	}
+	if v := get(c.chrome.AppleTouchIcon, "apple_touch_icon"); v != "" {
+		fmt.Fprintf(&buf, `<link rel="apple-touch-icon" href="%s">`+"\n", template.HTMLEscapeString(c.absURL(v)))
+	}
+	if v := get(c.chrome.Manifest, "manifest"); v != "" {
+		fmt.Fprintf(&buf, `<link rel="manifest" href="%s">`+"\n", template.HTMLEscapeString(c.absURL(v)))
+	}
+	return buf.String()
+}
+
+// jsEscape returns s escaped with template.JSEscapeString, which also
+// escapes non-printable characters, such as U+2028 and U+2029.
+func jsEscape(s string) string {
+	return template.JSEscapeString(s)
+}
+
+// LastUpdatedKey is the key of translated message used by `lastUpdated`
+// as format string for date, such as "Aktualisiert am %s". If catalog
+// has no such message, "Last updated on %s" is used even with strict
+// translations.
+const LastUpdatedKey = "lastUpdated"
+
+func (c *Collection) lastUpdated(st *renderState, page interface{}) (string, error) {
+	meta, err := metaOf(page)
+	if err != nil {
+		return "", fmt.Errorf("lastUpdated: %s", err)
+	}
+	date, ok, err := metaDate(meta, "lastmod")
+	if err == nil && !ok {
+		date, ok, err = metaDate(meta, "date")
+	}
+	if err != nil {
+		return "", fmt.Errorf("lastUpdated: %s", err)
+	}
+	if !ok {
+		return "", nil
+	}
+	format, ok := c.message(st, LastUpdatedKey)
+	if !ok {
+		format = "Last updated on %s"
+	}
+	return fmt.Sprintf(format, c.localizeDate(date, c.currentLocale(st), c.dateLayout)), nil
+}
+
+// parseHexColor parses color in #rgb or #rrggbb format
+// and returns its components in range [0, 1].
+func parseHexColor(s string) (rgb [3]float64, err error) {
+	h := strings.TrimPrefix(s, "#")
+	if len(h) == 3 {
+		h = string([]byte{h[0], h[0], h[1], h[1], h[2], h[2]})
+	}
+	if len(h) != 6 {
+		return rgb, fmt.Errorf("invalid color %q", s)
+	}
+	for i := range rgb {
+		v, err := strconv.ParseUint(h[i*2:i*2+2], 16, 8)
+		if err != nil {
+			return rgb, fmt.Errorf("invalid color %q", s)
+		}
+		rgb[i] = float64(v) / 255
+	}
+	return rgb, nil
+}
+
+func contrastColor(background string) (string, error) {
+	rgb, err := parseHexColor(background)
+	if err != nil {
+		return "", err
+	}
+	// Calculate relative luminance as defined by WCAG 2.0.
+	for i, v := range rgb {
+		if v <= 0.03928 {
+			rgb[i] = v / 12.92
+		} else {
+			rgb[i] = math.Pow((v+0.055)/1.055, 2.4)
+		}
+	}
+	l := 0.2126*rgb[0] + 0.7152*rgb[1] + 0.0722*rgb[2]
+	// Pick color with the higher contrast ratio.
+	if (l+0.05)/0.05 > 1.05/(l+0.05) {
+		return "#000000", nil
+	}
+	return "#ffffff", nil
+}
+
+func isValidURL(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// normalizeURL lowercases scheme and host, removes default port,
+// and resolves dot segments in path.
+func normalizeURL(s string) (string, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", err
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if (u.Scheme == "http" && strings.HasSuffix(u.Host, ":80")) ||
+		(u.Scheme == "https" && strings.HasSuffix(u.Host, ":443")) {
+		u.Host = u.Host[:strings.LastIndex(u.Host, ":")]
+	}
+	if u.Path != "" {
+		p := path.Clean(u.Path)
+		if strings.HasSuffix(u.Path, "/") && p != "/" {
+			p += "/"
+		}
+		u.Path = p
+	}
+	return u.String(), nil
+}
+
+var headingRx = regexp.MustCompile(`(?is)<h([1-6])[^>]*\sid=["']([^"']+)["'][^>]*>(.*?)</h[1-6]>`)
+
+func toc(content string, args ...interface{}) (string, error) {
+	minLevel, maxLevel, ordered := 1, 6, false
+	if len(args) > 3 {
+		return "", fmt.Errorf("toc: too many arguments")
+	}
+	for i, v := range args {
+		switch i {
+		case 0, 1:
+			n, ok := v.(int)
+			if !ok {
+				return "", fmt.Errorf("toc: heading level must be an integer")
+			}
+			if i == 0 {
+				minLevel = n
+			} else {
+				maxLevel = n
+			}
+		case 2:
+			b, ok := v.(bool)
+			if !ok {
+				return "", fmt.Errorf("toc: ordered flag must be a boolean")
+			}
+			ordered = b
+		}
+	}
+	openList, closeList := "<ul>", "</ul>"
+	if ordered {
+		openList, closeList = "<ol>", "</ol>"
+	}
+	var buf bytes.Buffer
+	var levels []int // stack of open list levels
+	for _, m := range headingRx.FindAllStringSubmatch(content, -1) {
+		level := int(m[1][0] - '0')
+		if level < minLevel || level > maxLevel {
+			continue
+		}
+		if len(levels) == 0 || level > levels[len(levels)-1] {
+			buf.WriteString(openList)
+			levels = append(levels, level)
+		} else {
+			for len(levels) > 1 && level < levels[len(levels)-1] {
+				buf.WriteString("</li>" + closeList)
+				levels = levels[:len(levels)-1]
+			}
+			if level > levels[len(levels)-1] {
+				buf.WriteString(openList)
+				levels = append(levels, level)
+			} else {
+				buf.WriteString("</li>")
+			}
+		}
+		fmt.Fprintf(&buf, `<li><a href="#%s">%s</a>`, m[2], strings.TrimSpace(utils.StripHTMLTags(m[3])))
+	}
+	for range levels {
+		buf.WriteString("</li>" + closeList)
+	}
+	return buf.String(), nil
+}
+
+// CountWords returns the number of words in HTML content.
+func CountWords(content string) int {
+	return len(strings.Fields(utils.StripHTMLTags(content)))
+}
+
+func (c *Collection) lengthClass(content string) string {
+	n := CountWords(content)
+	switch {
+	case n <= c.shortWords:
+		return "short"
+	case n >= c.longWords:
+		return "long"
+	default:
+		return "medium"
+	}
+}
+
+func (c *Collection) sanitize(html string) string {
+	if c.sanitizer == nil {
+		return template.HTMLEscapeString(html)
+	}
+	return c.sanitizer(html)
+}
+
+func (c *Collection) colorFrom(s string) string {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	sum := h.Sum32()
+	if len(c.colorPalette) > 0 {
+		return c.colorPalette[sum%uint32(len(c.colorPalette))]
+	}
+	return fmt.Sprintf("#%06x", sum&0xffffff)
+}
+
+func (c *Collection) wrapContainer(st *renderState, content string, opts ...map[string]interface{}) (string, error) {
+	c.mu.Lock()
+	if c.container == nil {
+		t, err := template.New("container").Funcs(c.funcs(nil)).Parse(DefaultContainerTemplate)
+		if err != nil {
+			c.mu.Unlock()
+			return "", err
+		}
+		c.container = t
+	}
+	t, err := c.bind(c.container, st)
+	c.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	options := make(map[string]interface{})
+	for _, o := range opts {
+		for k, v := range o {
+			options[k] = v
+		}
+	}
+	var buf bytes.Buffer
+	err = t.Execute(&buf, struct {
+		Content string
+		Options map[string]interface{}
+	}{
+		content,
+		options,
+	})
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// resourceTypes maps file extensions to resource types.
+var resourceTypes = map[string]string{
+	".woff2": "font",
+	".woff":  "font",
+	".ttf":   "font",
+	".otf":   "font",
+	".css":   "style",
+	".js":    "script",
+	".png":   "image",
+	".jpg":   "image",
+	".jpeg":  "image",
+	".gif":   "image",
+	".svg":   "image",
+	".webp":  "image",
+}
+
+func resourceHint(rel, href string, as ...string) (string, error) {
+	switch rel {
+	case "preload", "prefetch", "preconnect", "dns-prefetch", "prerender":
+	default:
+		return "", fmt.Errorf("resourceHint: unknown hint %q", rel)
+	}
+	typ := ""
+	if len(as) > 0 {
+		typ = as[0]
+	} else if rel == "preload" || rel == "prefetch" {
+		typ = resourceTypes[strings.ToLower(path.Ext(href))]
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<link rel="%s" href="%s"`, rel, template.HTMLEscapeString(href))
+	if typ != "" {
+		fmt.Fprintf(&buf, ` as="%s"`, template.HTMLEscapeString(typ))
+	}
+	// Fonts are always fetched in anonymous mode.
+	if typ == "font" || rel == "preconnect" {
+		buf.WriteString(" crossorigin")
+	}
+	buf.WriteString(">")
+	return buf.String(), nil
+}
+
+func humanizeDuration(v interface{}) (string, error) {
+	var d time.Duration
+	switch x := v.(type) {
+	case time.Duration:
+		d = x
+	case int:
+		d = time.Duration(x) * time.Second
+	case int64:
+		d = time.Duration(x) * time.Second
+	case float64:
+		d = time.Duration(x * float64(time.Second))
+	default:
+		return "", fmt.Errorf("humanizeDuration: %v is not a duration", v)
+	}
+	sign := ""
+	if d < 0 {
+		sign, d = "-", -d
+	}
+	switch {
+	case d == 0:
+		return "0s", nil
+	case d < time.Millisecond:
+		return sign + d.String(), nil
+	case d < time.Second:
+		return fmt.Sprintf("%s%dms", sign, d/time.Millisecond), nil
+	}
+	units := []struct {
+		name string
+		size time.Duration
+	}{
+		{"d", 24 * time.Hour},
+		{"h", time.Hour},
+		{"m", time.Minute},
+		{"s", time.Second},
+	}
+	// Output at most two most significant units.
+	var parts []string
+	for _, u := range units {
+		if len(parts) == 2 {
+			break
+		}
+		n := d / u.size
+		d -= n * u.size
+		if n > 0 {
+			parts = append(parts, fmt.Sprintf("%d%s", n, u.name))
+		} else if len(parts) > 0 {
+			break
+		}
+	}
+	return sign + strings.Join(parts, " "), nil
+}
+
+func dict(pairs ...interface{}) (map[string]interface{}, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("dict: odd number of arguments")
+	}
+	m := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict: key %v is not a string", pairs[i])
+		}
+		m[key] = pairs[i+1]
+	}
+	return m, nil
+}
+
+func classnames(args ...interface{}) (string, error) {
+	var names []string
+	seen := make(map[string]bool)
+	add := func(s string) {
+		for _, name := range strings.Fields(s) {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	for _, arg := range args {
+		switch x := arg.(type) {
+		case nil:
+			// skip
+		case string:
+			add(x)
+		case map[string]interface{}:
+			keys := make([]string, 0, len(x))
+			for k := range x {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				if truth, _ := template.IsTrue(x[k]); truth {
+					add(k)
+				}
+			}
+		default:
+			return "", fmt.Errorf("classnames: unsupported argument %T", arg)
+		}
+	}
+	return strings.Join(names, " "), nil
+}
+
+// ReadingMeta describes length of content.
+type ReadingMeta struct {
+	Words   int
+	Minutes int    // estimated reading time
+	Text    string // e.g. "8 min read · 1,600 words"
+}
+
+func (m *ReadingMeta) String() string { return m.Text }
+
+func (c *Collection) readingMeta(st *renderState, content string) (*ReadingMeta, error) {
+	m := &ReadingMeta{Words: CountWords(content)}
+	if m.Words > 0 && c.wordsPerMinute > 0 {
+		m.Minutes = (m.Words + c.wordsPerMinute - 1) / c.wordsPerMinute
+	}
+	words, err := c.localizeNumber(m.Words, c.currentLocale(st))
+	if err != nil {
+		return nil, err
+	}
+	m.Text = fmt.Sprintf("%d min read · %s words", m.Minutes, words)
+	return m, nil
+}
+
+// MoreSeparator separates summary from the rest of content.
+const MoreSeparator = "<!--more-->"
+
+// Summarizer is implemented by pages which have explicit summary.
+type Summarizer interface {
+	Summary() string
+}
+
+func (c *Collection) summaryOf(st *renderState, page interface{}) (string, error) {
+	var content string
+	if s, ok := page.(string); ok {
+		content = s
+	} else {
+		p, err := c.pageOf(st, page)
+		if err != nil {
+			return "", fmt.Errorf("summaryOf: %s", err)
+		}
+		page = p
+		content = p.Content()
+	}
+	if s, ok := page.(Summarizer); ok {
+		if summary := s.Summary(); summary != "" {
+			return summary, nil
+		}
+	}
+	if i := strings.Index(content, MoreSeparator); i >= 0 {
+		return content[:i], nil
+	}
+	words := strings.Fields(utils.StripHTMLTags(content))
+	if len(words) > c.summaryWords {
+		return strings.Join(words[:c.summaryWords], " ") + "...", nil
+	}
+	return strings.Join(words, " "), nil
+}
+
+func (c *Collection) feedLink(title, url, typ string) string {
+	return fmt.Sprintf(`<link rel="alternate" type="%s" title="%s" href="%s">`,
+		template.HTMLEscapeString(typ),
+		template.HTMLEscapeString(title),
+		template.HTMLEscapeString(c.absURL(url)))
+}
+
+// stringMap converts map with string keys, such as decoded from YAML,
+// into map[string]interface{}.
+func stringMap(v interface{}) (map[string]interface{}, bool) {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[string]string:
+		out := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			out[k] = v
+		}
+		return out, true
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			out[fmt.Sprint(k)] = v
+		}
+		return out, true
+	}
+	// Other maps with string keys, such as named map types.
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+	out := make(map[string]interface{}, rv.Len())
+	for _, k := range rv.MapKeys() {
+		out[k.String()] = rv.MapIndex(k).Interface()
+	}
+	return out, true
+}
+
+func (c *Collection) kvtable(v interface{}) (string, error) {
+	m, ok := stringMap(v)
+	if !ok {
+		return "", fmt.Errorf("kvtable: %T is not a map", v)
+	}
+	var buf bytes.Buffer
+	buf.WriteString("<table>")
+	c.writeKVRows(&buf, "", m)
+	buf.WriteString("</table>")
+	return buf.String(), nil
+}
+
+func (c *Collection) writeKVRows(buf *bytes.Buffer, prefix string, m map[string]interface{}) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		nested, isMap := stringMap(m[k])
+		if isMap && c.kvtableFlat {
+			c.writeKVRows(buf, prefix+k+".", nested)
+			continue
+		}
+		fmt.Fprintf(buf, "<tr><th>%s</th><td>", template.HTMLEscapeString(prefix+k))
+		if isMap {
+			buf.WriteString("<table>")
+			c.writeKVRows(buf, "", nested)
+			buf.WriteString("</table>")
+		} else {
+			buf.WriteString(template.HTMLEscapeString(fmt.Sprint(m[k])))
+		}
+		buf.WriteString("</td></tr>")
+	}
+}
+
+// toFloat converts number to float64.
+func toFloat(v interface{}) (float64, error) {
+	switch x := v.(type) {
+	case int:
+		return float64(x), nil
+	case int64:
+		return float64(x), nil
+	case uint:
+		return float64(x), nil
+	case uint64:
+		return float64(x), nil
+	case float32:
+		return float64(x), nil
+	case float64:
+		return x, nil
+	}
+	return 0, fmt.Errorf("%v is not a number", v)
+}
+
+func (c *Collection) ratio(a, b interface{}) (float64, error) {
+	x, err := toFloat(a)
+	if err != nil {
+		return 0, fmt.Errorf("ratio: %s", err)
+	}
+	y, err := toFloat(b)
+	if err != nil {
+		return 0, fmt.Errorf("ratio: %s", err)
+	}
+	if y == 0 {
+		if c.divByZeroError {
+			return 0, fmt.Errorf("ratio: division by zero")
+		}
+		return 0, nil
+	}
+	return x / y, nil
+}
+
+func (c *Collection) percent(part, whole interface{}, decimals ...int) (string, error) {
+	if len(decimals) > 1 {
+		return "", fmt.Errorf("percent: too many arguments")
+	}
+	prec := 0
+	if len(decimals) == 1 {
+		prec = decimals[0]
+	}
+	r, err := c.ratio(part, whole)
+	if err != nil {
+		return "", fmt.Errorf("percent: %s", strings.TrimPrefix(err.Error(), "ratio: "))
+	}
+	return strconv.FormatFloat(r*100, 'f', prec, 64) + "%", nil
+}
+
+func (c *Collection) consentScript(category, src string) string {
+	if c.consentChecker != nil && c.consentChecker(category) {
+		return fmt.Sprintf(`<script src="%s"></script>`, template.HTMLEscapeString(src))
+	}
+	return fmt.Sprintf(`<script type="text/plain" data-consent="%s" data-src="%s"></script>`,
+		template.HTMLEscapeString(category), template.HTMLEscapeString(src))
+}
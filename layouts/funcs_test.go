@@ -0,0 +1,1239 @@
+// Copyright 2013 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package layouts
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dchest/kkr/utils"
+)
+
+func TestCleanContent(t *testing.T) {
+	in := "\ufeffHello  \r\nworld\t\r\n\r\nend \rline"
+	exp := "Hello\nworld\n\nend\nline"
+	if out := cleanContent(in); out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+}
+
+func TestJSONLD(t *testing.T) {
+	out, err := jsonld(map[string]interface{}{
+		"@type": "Article",
+		"name":  "</script><b>",
+	})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	exp := `<script type="application/ld+json">{"@type":"Article","name":"\u003c/script\u003e\u003cb\u003e"}</script>`
+	if out != exp {
+		t.Errorf("expected\n%s\ngot\n%s", exp, out)
+	}
+}
+
+func TestPermalink(t *testing.T) {
+	c := newTestCollection()
+	meta := map[string]interface{}{
+		"title":    "Hello, World!",
+		"date":     time.Date(2013, 10, 18, 0, 0, 0, 0, time.UTC),
+		"category": "Go News",
+	}
+	c.SetPermalinkPattern("/:category/:year/:month/:slug/")
+	out, err := c.permalink(meta)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if exp := "/go-news/2013/10/hello-world/"; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+	c.SetPermalinkPattern("/:year/:unknown/")
+	if _, err := c.permalink(meta); err == nil {
+		t.Errorf("expected error for unknown placeholder")
+	}
+}
+
+func TestTmpl(t *testing.T) {
+	c := newTestCollection()
+	p := &testPage{
+		meta: map[string]interface{}{
+			"card": `[{{.name}}: {{.price}}]`,
+			"item": map[string]interface{}{"name": "Tea", "price": 3},
+		},
+		content: `{{tmpl .Page.card .Page.item}}`,
+	}
+	out, err := c.RenderPage(p, "none")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if exp := "[Tea: 3]"; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+	// Recursive template.
+	s := `{{tmpl . .}}`
+	if _, err := c.tmpl(nil, s, s); err == nil {
+		t.Errorf("expected error for recursive tmpl")
+	}
+}
+
+func TestContrastColor(t *testing.T) {
+	var tests = []struct{ in, out string }{
+		{"#000", "#ffffff"},
+		{"#1a237e", "#ffffff"},
+		{"#ffffff", "#000000"},
+		{"fff59d", "#000000"},
+	}
+	for i, v := range tests {
+		out, err := contrastColor(v.in)
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		if out != v.out {
+			t.Errorf("%d: expected %q, got %q", i, v.out, out)
+		}
+	}
+	for _, v := range []string{"#12", "#ggg", ""} {
+		if _, err := contrastColor(v); err == nil {
+			t.Errorf("expected error for %q", v)
+		}
+	}
+}
+
+func TestURLs(t *testing.T) {
+	if !isValidURL("https://example.com/path?q=1") {
+		t.Errorf("expected valid URL")
+	}
+	for _, v := range []string{"example.com", "http://", "ftp://example.com/", "http://exa mple.com/"} {
+		if isValidURL(v) {
+			t.Errorf("expected %q to be invalid", v)
+		}
+	}
+	out, err := normalizeURL("HTTP://Example.COM:80/a/b/../c/./d/?x=1#top")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if exp := "http://example.com/a/c/d/?x=1#top"; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+}
+
+func TestTOC(t *testing.T) {
+	content := `<h1 id="title">Title</h1>
+<h2 id="intro">Intro</h2>
+<h3 id="why">Why <em>this</em></h3>
+<h4 id="deep">Deep</h4>
+<h3 id="how">How</h3>
+<h2 id="end">End</h2>`
+	var tests = []struct {
+		args []interface{}
+		out  string
+	}{
+		{
+			[]interface{}{2, 3},
+			`<ul><li><a href="#intro">Intro</a><ul><li><a href="#why">Why this</a></li><li><a href="#how">How</a></li></ul></li><li><a href="#end">End</a></li></ul>`,
+		},
+		{
+			[]interface{}{2, 3, true},
+			`<ol><li><a href="#intro">Intro</a><ol><li><a href="#why">Why this</a></li><li><a href="#how">How</a></li></ol></li><li><a href="#end">End</a></li></ol>`,
+		},
+		{
+			[]interface{}{3, 4},
+			`<ul><li><a href="#why">Why this</a><ul><li><a href="#deep">Deep</a></li></ul></li><li><a href="#how">How</a></li></ul>`,
+		},
+	}
+	for i, v := range tests {
+		out, err := toc(content, v.args...)
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		if out != v.out {
+			t.Errorf("%d: expected\n%s\ngot\n%s", i, v.out, out)
+		}
+	}
+}
+
+func TestLengthClass(t *testing.T) {
+	c := newTestCollection()
+	c.SetLengthThresholds(3, 5)
+	var tests = []struct{ in, out string }{
+		{"", "short"},
+		{"<p>one two three</p>", "short"},
+		{"one two three four", "medium"},
+		{"one <b>two</b> three four five", "long"},
+		{"one two three four five six", "long"},
+	}
+	for i, v := range tests {
+		if out := c.lengthClass(v.in); out != v.out {
+			t.Errorf("%d: expected %q, got %q", i, v.out, out)
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	in := `<p>Hi<script>alert(1)</script></p>`
+	c := newTestCollection()
+	if out, exp := c.sanitize(in), `&lt;p&gt;Hi&lt;script&gt;alert(1)&lt;/script&gt;&lt;/p&gt;`; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+	rx := regexp.MustCompile(`(?is)<script.*?</script>`)
+	c.SetSanitizer(func(html string) string {
+		return rx.ReplaceAllString(html, "")
+	})
+	if out := renderString(t, c, `{{sanitize "`+strings.Replace(in, `"`, `\"`, -1)+`"}}`); out != "<p>Hi</p>" {
+		t.Errorf("expected %q, got %q", "<p>Hi</p>", out)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	c := newTestCollection()
+	c.SetUndatedLabel("Someday")
+	page := func(title, date string) map[string]interface{} {
+		m := map[string]interface{}{"title": title}
+		if date != "" {
+			m["date"] = date
+		}
+		return m
+	}
+	posts := []map[string]interface{}{
+		page("a", "2012-11-02"),
+		page("b", "2013-01-05"),
+		page("c", ""),
+		page("d", "2012-11-20"),
+		page("e", "2013-03-01"),
+		page("f", "2012-02-14"),
+	}
+	years, err := c.archive(posts)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	var out []string
+	for _, y := range years {
+		for _, m := range y.Months {
+			s := y.Label + "/" + strconv.Itoa(int(m.Month)) + ":"
+			for _, p := range m.Posts {
+				s += p.(map[string]interface{})["title"].(string)
+			}
+			out = append(out, s)
+		}
+	}
+	exp := []string{"2013/3:e", "2013/1:b", "2012/11:da", "2012/2:f", "Someday/0:c"}
+	if strings.Join(out, " ") != strings.Join(exp, " ") {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+}
+
+func TestLinkify(t *testing.T) {
+	var tests = []struct{ in, out string }{
+		{
+			`See http://example.com/a?b=1&amp;c=2 now`,
+			`See <a href="http://example.com/a?b=1&amp;c=2">http://example.com/a?b=1&amp;c=2</a> now`,
+		},
+		{
+			`Go to https://golang.org.`,
+			`Go to <a href="https://golang.org">https://golang.org</a>.`,
+		},
+		{
+			`<a href="http://example.com/">http://example.com/</a> and <code>http://localhost/</code>`,
+			`<a href="http://example.com/">http://example.com/</a> and <code>http://localhost/</code>`,
+		},
+	}
+	for i, v := range tests {
+		out, err := linkify(v.in)
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		if out != v.out {
+			t.Errorf("%d: expected\n%s\ngot\n%s", i, v.out, out)
+		}
+	}
+}
+
+func TestColorFrom(t *testing.T) {
+	c := newTestCollection()
+	a := c.colorFrom("golang")
+	if len(a) != 7 || a[0] != '#' {
+		t.Errorf("bad color %q", a)
+	}
+	if b := c.colorFrom("golang"); a != b {
+		t.Errorf("color is not deterministic: %q != %q", a, b)
+	}
+	palette := []string{"red", "green", "blue"}
+	c.SetColorPalette(palette)
+	seen := make(map[string]bool)
+	for _, s := range []string{"go", "rust", "c", "python", "ruby", "perl"} {
+		color := c.colorFrom(s)
+		if color != c.colorFrom(s) {
+			t.Errorf("color is not deterministic for %q", s)
+		}
+		seen[color] = true
+	}
+	for color := range seen {
+		if color != "red" && color != "green" && color != "blue" {
+			t.Errorf("color %q not from palette", color)
+		}
+	}
+}
+
+func TestContainer(t *testing.T) {
+	c := newTestCollection()
+	out := renderString(t, c, `{{container "Hi"}}`)
+	if exp := `<div class="container">Hi</div>`; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+	if err := c.SetContainerTemplate(`<section class="wrap {{.Options.size}}">{{.Content}}</section>`); err != nil {
+		t.Fatalf("%s", err)
+	}
+	out, err := c.RenderPage(&testPage{
+		meta:    map[string]interface{}{"opts": map[string]interface{}{"size": "wide"}},
+		content: `{{container "Hi" .Page.opts}}`,
+	}, "none")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if exp := `<section class="wrap wide">Hi</section>`; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+}
+
+func TestTaxonomyNeighbors(t *testing.T) {
+	post := func(url, date, category string) map[string]interface{} {
+		return map[string]interface{}{"url": url, "date": date, "category": category}
+	}
+	posts := []map[string]interface{}{
+		post("/go2/", "2013-03-01", "go"),
+		post("/c1/", "2013-02-01", "c"),
+		post("/go1/", "2013-01-01", "go"),
+		post("/c2/", "2013-04-01", "c"),
+		post("/go3/", "2013-05-01", "go"),
+	}
+	url := func(p interface{}) string {
+		if p == nil {
+			return ""
+		}
+		return p.(map[string]interface{})["url"].(string)
+	}
+	var tests = []struct{ page, category, prev, next string }{
+		{"/go2/", "go", "/go1/", "/go3/"},
+		{"/go1/", "go", "", "/go2/"},
+		{"/go3/", "go", "/go2/", ""},
+		{"/c1/", "c", "", "/c2/"},
+	}
+	for i, v := range tests {
+		prev, err := prevInTaxonomy(v.page, posts, "category", v.category)
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		next, err := nextInTaxonomy(v.page, posts, "category", v.category)
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		if url(prev) != v.prev || url(next) != v.next {
+			t.Errorf("%d: expected %q, %q, got %q, %q", i, v.prev, v.next, url(prev), url(next))
+		}
+	}
+}
+
+func TestResourceHint(t *testing.T) {
+	var tests = []struct {
+		args []string
+		out  string
+	}{
+		{[]string{"preload", "/fonts/x.woff2", "font"}, `<link rel="preload" href="/fonts/x.woff2" as="font" crossorigin>`},
+		{[]string{"preload", "/fonts/x.woff"}, `<link rel="preload" href="/fonts/x.woff" as="font" crossorigin>`},
+		{[]string{"preload", "/css/main.css"}, `<link rel="preload" href="/css/main.css" as="style">`},
+		{[]string{"prefetch", "/js/app.js", "script"}, `<link rel="prefetch" href="/js/app.js" as="script">`},
+	}
+	for i, v := range tests {
+		out, err := resourceHint(v.args[0], v.args[1], v.args[2:]...)
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		if out != v.out {
+			t.Errorf("%d: expected\n%s\ngot\n%s", i, v.out, out)
+		}
+	}
+	if _, err := resourceHint("bogus", "/x.js"); err == nil {
+		t.Errorf("expected error for unknown hint")
+	}
+}
+
+func TestHumanizeDuration(t *testing.T) {
+	var tests = []struct {
+		in  interface{}
+		out string
+	}{
+		{time.Duration(0), "0s"},
+		{0, "0s"},
+		{250 * time.Millisecond, "250ms"},
+		{42, "42s"},
+		{90, "1m 30s"},
+		{1*time.Hour + 23*time.Minute + 45*time.Second, "1h 23m"},
+		{2*time.Hour + 5*time.Second, "2h"},
+		{3*24*time.Hour + 4*time.Hour + 5*time.Minute, "3d 4h"},
+		{-90 * time.Second, "-1m 30s"},
+	}
+	for i, v := range tests {
+		out, err := humanizeDuration(v.in)
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		if out != v.out {
+			t.Errorf("%d: expected %q, got %q", i, v.out, out)
+		}
+	}
+}
+
+func TestClassnames(t *testing.T) {
+	c := newTestCollection()
+	out, err := c.RenderPage(&testPage{
+		meta:    map[string]interface{}{"active": true},
+		content: `{{classnames "btn btn-large" (dict "active" .Page.active "disabled" false "btn" true) "large"}}`,
+	}, "none")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if exp := "btn btn-large active large"; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+	if _, err := dict("a"); err == nil {
+		t.Errorf("expected error for odd number of dict arguments")
+	}
+}
+
+func TestReadingMeta(t *testing.T) {
+	c := newTestCollection()
+	content := "<p>" + strings.Repeat("word ", 1600) + "</p>"
+	m, err := c.readingMeta(nil, content)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if m.Words != 1600 || m.Minutes != 8 {
+		t.Errorf("expected 1600 words, 8 minutes, got %d, %d", m.Words, m.Minutes)
+	}
+	if exp := "8 min read · 1,600 words"; m.Text != exp {
+		t.Errorf("expected %q, got %q", exp, m.Text)
+	}
+	if m, _ := c.readingMeta(nil, "just three words"); m.Minutes != 1 {
+		t.Errorf("expected 1 minute, got %d", m.Minutes)
+	}
+	c.SetWordsPerMinute(400)
+	if m, _ := c.readingMeta(nil, content); m.Minutes != 4 {
+		t.Errorf("expected 4 minutes, got %d", m.Minutes)
+	}
+}
+
+func TestSummaryOf(t *testing.T) {
+	c := newTestCollection()
+	long := strings.Repeat("word ", DefaultSummaryWords+10)
+	exp := strings.TrimSpace(strings.Repeat("word ", DefaultSummaryWords)) + "..."
+	if out, _ := c.summaryOf(nil, long); out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+	if out, _ := c.summaryOf(nil, "alpha beta gamma"); out != "alpha beta gamma" {
+		t.Errorf("expected %q, got %q", "alpha beta gamma", out)
+	}
+	c.SetSummaryWords(3)
+	var tests = []struct {
+		page interface{}
+		out  string
+	}{
+		{&testPage{content: "<p>Intro text.</p><!--more--><p>Rest</p>"}, "<p>Intro text.</p>"},
+		{&testPage{content: "<p>One two three four five</p>"}, "One two three..."},
+		{"<p>One two</p>", "One two"},
+	}
+	for i, v := range tests {
+		out, err := c.summaryOf(nil, v.page)
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		if out != v.out {
+			t.Errorf("%d: expected %q, got %q", i, v.out, out)
+		}
+	}
+	// Page meta.
+	post := &testPage{url: "/post/", content: "<p>Post intro</p><!--more--><p>Rest</p>"}
+	c.SetPageResolver(func(url string) (PageContext, error) {
+		if url != post.url {
+			return nil, fmt.Errorf("page %q not found", url)
+		}
+		return post, nil
+	})
+	out, err := c.RenderPage(&testPage{
+		meta:    map[string]interface{}{"url": "/", "post": map[string]interface{}{"url": "/post/"}},
+		url:     "/",
+		content: `<p>Page intro</p><!--more-->{{summaryOf .Page}}|{{summaryOf .Page.post}}`,
+	}, "none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := "<p>Page intro</p><!--more--><p>Page intro</p>|<p>Post intro</p>"; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+}
+
+func TestFeedLinks(t *testing.T) {
+	c := newTestCollection()
+	c.SetBaseURL("http://example.com")
+	out := renderString(t, c, `{{rssLink "News & Views" "/feed.rss"}}
+{{atomLink "Blog" "https://blog.example.com/feed.xml"}}`)
+	exp := `<link rel="alternate" type="application/rss+xml" title="News &amp; Views" href="http://example.com/feed.rss">
+<link rel="alternate" type="application/atom+xml" title="Blog" href="https://blog.example.com/feed.xml">`
+	if out != exp {
+		t.Errorf("expected\n%s\ngot\n%s", exp, out)
+	}
+}
+
+func TestKVTable(t *testing.T) {
+	c := newTestCollection()
+	flat := map[string]interface{}{"b": 2, "a": "x<y"}
+	out, err := c.kvtable(flat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := `<table><tr><th>a</th><td>x&lt;y</td></tr><tr><th>b</th><td>2</td></tr></table>`
+	if out != exp {
+		t.Errorf("flat: expected\n%s\ngot\n%s", exp, out)
+	}
+
+	nested := map[string]interface{}{
+		"title": "Site",
+		"build": map[interface{}]interface{}{"minify": true, "gzip": false},
+	}
+	out, err = c.kvtable(nested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp = `<table><tr><th>build</th><td><table><tr><th>gzip</th><td>false</td></tr><tr><th>minify</th><td>true</td></tr></table></td></tr><tr><th>title</th><td>Site</td></tr></table>`
+	if out != exp {
+		t.Errorf("nested: expected\n%s\ngot\n%s", exp, out)
+	}
+
+	c.SetKVTableFlatten(true)
+	out, err = c.kvtable(nested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp = `<table><tr><th>build.gzip</th><td>false</td></tr><tr><th>build.minify</th><td>true</td></tr><tr><th>title</th><td>Site</td></tr></table>`
+	if out != exp {
+		t.Errorf("flattened: expected\n%s\ngot\n%s", exp, out)
+	}
+}
+
+func TestPercentRatio(t *testing.T) {
+	c := newTestCollection()
+	out := renderString(t, c, `{{percent 42 100}} {{percent 1 3 1}} {{percent 0.5 2}} {{ratio 3 4}} {{percent 5 0}} {{ratio 5 0}}`)
+	if exp := "42% 33.3% 25% 0.75 0% 0"; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+	c.SetDivisionByZeroError(true)
+	if _, err := c.percent(5, 0); err == nil {
+		t.Errorf("percent: expected division by zero error")
+	}
+	if _, err := c.ratio(5, 0); err == nil {
+		t.Errorf("ratio: expected division by zero error")
+	}
+}
+
+func TestConsentScript(t *testing.T) {
+	c := newTestCollection()
+	c.SetConsentChecker(func(category string) bool {
+		return category == "necessary"
+	})
+	out := renderString(t, c, `{{consentScript "necessary" "/js/app.js"}}
+{{consentScript "analytics" "/js/stats.js?a=1&b=2"}}`)
+	exp := `<script src="/js/app.js"></script>
+<script type="text/plain" data-consent="analytics" data-src="/js/stats.js?a=1&amp;b=2"></script>`
+	if out != exp {
+		t.Errorf("expected\n%s\ngot\n%s", exp, out)
+	}
+}
+
+func TestPlaceholder(t *testing.T) {
+	c := newTestCollection()
+	c.AddInclude("skeleton-card", `<div class="skeleton card"></div>`)
+	c.SetPlaceholder("card", "skeleton-card")
+	out := renderString(t, c, `{{placeholder "card"}}`)
+	if exp := `<div class="skeleton card"></div>`; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+	if _, err := c.placeholder(nil, "list"); err == nil {
+		t.Errorf("expected error for unknown placeholder")
+	}
+}
+
+func TestURLDepth(t *testing.T) {
+	var tests = []struct {
+		url   string
+		depth int
+	}{
+		{"/", 0},
+		{"", 0},
+		{"/blog/", 1},
+		{"/blog", 1},
+		{"/blog/2016/05/post/", 4},
+		{"http://example.com/a/b/?q=1#c", 2},
+	}
+	for _, v := range tests {
+		n, err := urlDepth(v.url)
+		if err != nil {
+			t.Fatalf("%q: %s", v.url, err)
+		}
+		if n != v.depth {
+			t.Errorf("%q: expected %d, got %d", v.url, v.depth, n)
+		}
+	}
+}
+
+func TestDataURI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "layouts-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "img"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "img", "dot.png"), []byte("PNG"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "img", "big.png"), make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestCollection()
+	c.SetDataURIRoot(dir, 10)
+	out, err := c.datauri("/img/dot.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := "data:image/png;base64,UE5H"; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+	if _, err := c.datauri("/img/big.png"); err == nil {
+		t.Errorf("expected error for file exceeding maximum size")
+	}
+	// Paths can't escape root.
+	out, err = c.datauri("../../img/dot.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := "data:image/png;base64,UE5H"; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+}
+
+func TestMenuTree(t *testing.T) {
+	items := []interface{}{
+		map[interface{}]interface{}{"id": "docs", "title": "Docs", "weight": 2},
+		map[interface{}]interface{}{"id": "home", "title": "Home", "weight": 1},
+		map[interface{}]interface{}{"id": "api", "title": "API", "parent": "docs", "weight": 2},
+		map[interface{}]interface{}{"id": "guide", "title": "Guide", "parent": "docs", "weight": 1},
+		map[interface{}]interface{}{"id": "lost", "title": "Lost", "parent": "missing", "weight": 3},
+	}
+	tree, err := menuTree(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var format func(items []*MenuItem) string
+	format = func(items []*MenuItem) string {
+		var parts []string
+		for _, mi := range items {
+			s := mi.Item.(map[interface{}]interface{})["title"].(string)
+			if len(mi.Children) > 0 {
+				s += "(" + format(mi.Children) + ")"
+			}
+			parts = append(parts, s)
+		}
+		return strings.Join(parts, " ")
+	}
+	if out, exp := format(tree), "Home Docs(Guide API) Lost"; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+}
+
+func TestSortedKeys(t *testing.T) {
+	m := map[interface{}]interface{}{"b": 2, "a": 1, 3: "three", "c": 3}
+	for i := 0; i < 10; i++ {
+		keys, err := sortedKeys(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out, exp := strings.Join(keys, " "), "3 a b c"; out != exp {
+			t.Fatalf("expected %q, got %q", exp, out)
+		}
+	}
+	c := NewCollection(&testSite{data: map[string]interface{}{"z": 26, "x": 24, "y": 25}, funcs: FuncMap{}})
+	for i := 0; i < 10; i++ {
+		out := renderString(t, c, `{{range rangeSorted .Site}}{{.Key}}={{.Value}} {{end}}`)
+		if exp := "x=24 y=25 z=26 "; out != exp {
+			t.Fatalf("expected %q, got %q", exp, out)
+		}
+	}
+}
+
+func TestChecklink(t *testing.T) {
+	c := newTestCollection()
+	c.SetBaseURL("http://example.com")
+	c.SetKnownURLs([]string{"/", "/about/"}, true)
+	out := renderString(t, c, `{{checklink "/about/#team"}} {{checklink "http://example.com/"}} {{checklink "https://golang.org/x/"}}`)
+	if exp := "/about/#team http://example.com/ https://golang.org/x/"; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+	if _, err := c.checklink(nil, "/contact/"); err == nil {
+		t.Errorf("expected error for unknown URL in strict mode")
+	}
+
+	c.SetKnownURLs([]string{"/"}, false)
+	page := &testPage{url: "/a/", content: `{{checklink "/contact/"}}`, source: "a.html"}
+	if _, err := c.RenderPage(page, "none"); err != nil {
+		t.Fatalf("lenient mode: %s", err)
+	}
+	w := c.Warnings()
+	if len(w) != 1 || w[0].Category != BrokenLinkWarning || w[0].Filename != "a.html" {
+		t.Errorf("unexpected warnings: %v", w)
+	}
+}
+
+func TestJSONFeed(t *testing.T) {
+	c := newTestCollection()
+	c.SetBaseURL("http://example.com")
+	site := struct{ Name, URL string }{"Blog", "http://example.com/"}
+	posts := []PageContext{
+		&testPage{
+			meta:    map[string]interface{}{"title": "Second", "date": time.Date(2016, 5, 2, 10, 0, 0, 0, time.UTC)},
+			url:     "/blog/second/",
+			content: "<p>Two & more</p>",
+		},
+		&testPage{
+			meta:    map[string]interface{}{"title": "First", "date": "2016-05-01"},
+			url:     "/blog/first/",
+			content: "<p>One</p>",
+		},
+	}
+	out, err := c.jsonfeed(site, posts, map[string]interface{}{"feed_url": "/feed.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.ContainsAny(out, "<>&") {
+		t.Errorf("HTML characters not escaped: %s", out)
+	}
+	var feed map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &feed); err != nil {
+		t.Fatal(err)
+	}
+	exp := map[string]interface{}{
+		"version":       "https://jsonfeed.org/version/1",
+		"title":         "Blog",
+		"home_page_url": "http://example.com/",
+		"feed_url":      "http://example.com/feed.json",
+		"items": []interface{}{
+			map[string]interface{}{
+				"id":             "http://example.com/blog/second/",
+				"url":            "http://example.com/blog/second/",
+				"title":          "Second",
+				"content_html":   "<p>Two & more</p>",
+				"date_published": "2016-05-02T10:00:00Z",
+			},
+			map[string]interface{}{
+				"id":             "http://example.com/blog/first/",
+				"url":            "http://example.com/blog/first/",
+				"title":          "First",
+				"content_html":   "<p>One</p>",
+				"date_published": "2016-05-01T00:00:00Z",
+			},
+		},
+	}
+	if !reflect.DeepEqual(feed, exp) {
+		t.Errorf("expected\n%v\ngot\n%v", exp, feed)
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	var tests = []struct {
+		values []interface{}
+		out    interface{}
+	}{
+		{[]interface{}{nil, "", "/img/section.png", "/img/site.png"}, "/img/section.png"},
+		{[]interface{}{"/img/page.png", "/img/site.png"}, "/img/page.png"},
+		{[]interface{}{0, 5}, 5},
+		{[]interface{}{nil, false, []string{}, ""}, ""},
+		{[]interface{}{"", 0}, 0},
+		{nil, nil},
+	}
+	for i, v := range tests {
+		if out := coalesce(v.values...); !reflect.DeepEqual(out, v.out) {
+			t.Errorf("%d: expected %#v, got %#v", i, v.out, out)
+		}
+	}
+	c := newTestCollection()
+	out := renderString(t, c, `{{"" | default "x"}} {{"y" | default "x"}} {{coalesce .Page.image "z"}}`)
+	if exp := "x y z"; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+}
+
+func TestSafeRangeIndex(t *testing.T) {
+	c := newTestCollection()
+	page := &testPage{
+		meta: map[string]interface{}{
+			"links": []interface{}{"a", "b"},
+			"nested": map[interface{}]interface{}{
+				"x": map[interface{}]interface{}{"y": "z"},
+			},
+		},
+		url: "/a/",
+		content: `{{range safeRange .Page.missing}}x{{end}}[{{range safeRange .Page.links}}{{.}}{{end}}]` +
+			`{{safeIndex .Page.missing "key"}} {{safeIndex .Page.nested "x" "y"}} {{safeIndex .Page.links 5}} {{safeIndex .Page.links 1}}`,
+	}
+	out, err := c.RenderPage(page, "none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := "[ab]<no value> z <no value> b"; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+}
+
+func TestSample(t *testing.T) {
+	list := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	c := newTestCollection()
+	c.SetSeed(42)
+	first, err := c.sample(list, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 3 {
+		t.Fatalf("expected 3 items, got %v", first)
+	}
+	for i := 0; i < 5; i++ {
+		again, err := c.sample(list, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(first, again) {
+			t.Fatalf("not deterministic: %v and %v", first, again)
+		}
+	}
+	if list[0] != "a" || list[7] != "h" {
+		t.Errorf("original list modified: %v", list)
+	}
+	differ := false
+	for seed := int64(0); seed < 10 && !differ; seed++ {
+		c.SetSeed(seed)
+		other, _ := c.sample(list, 3)
+		differ = !reflect.DeepEqual(first, other)
+	}
+	if !differ {
+		t.Errorf("selection doesn't depend on seed")
+	}
+	all, err := c.sample(list, 20, "featured")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != len(list) {
+		t.Errorf("expected %d items, got %v", len(list), all)
+	}
+}
+
+func TestPageID(t *testing.T) {
+	a1 := &testPage{url: "/a/", source: "pages/a.html"}
+	a2 := &testPage{url: "/renamed/", source: "pages/a.html"}
+	b := &testPage{url: "/b/", source: "pages/b.html"}
+	idA1, err := pageID(a1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idA2, _ := pageID(a2)
+	idB, _ := pageID(b)
+	if idA1 != idA2 {
+		t.Errorf("same source path, different ids: %q and %q", idA1, idA2)
+	}
+	if idA1 == idB {
+		t.Errorf("different source paths, same id %q", idA1)
+	}
+	if _, err := pageID(&testPage{url: "/c/"}); err == nil {
+		t.Errorf("expected error for page without source")
+	}
+	c := newTestCollection()
+	out, err := c.RenderPage(&testPage{url: "/a/", source: "pages/a.html", content: `{{.Page.id}} {{pageID .Page}}`}, "none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := idA1 + " " + idA1; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+	out, err = c.RenderLocalized(&testPage{url: "/a/", source: "pages/a.html", content: `{{.Page.id}}`}, "none", "fr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != idA1 {
+		t.Errorf("expected localized page id %q, got %q", idA1, out)
+	}
+	// Pages without SourcePath method.
+	out, err = c.RenderPage(pageWithoutSource{&testPage{url: "/d/", content: `{{with .Page.id}}{{.}}{{else}}none{{end}}`}}, "none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "none" {
+		t.Errorf("expected %q, got %q", "none", out)
+	}
+}
+
+// pageWithoutSource is a page which doesn't implement SourcePath.
+type pageWithoutSource struct {
+	p *testPage
+}
+
+func (p pageWithoutSource) Meta() map[string]interface{} { return p.p.Meta() }
+func (p pageWithoutSource) Content() string              { return p.p.Content() }
+func (p pageWithoutSource) URL() string                  { return p.p.URL() }
+func (p pageWithoutSource) FileInfo() os.FileInfo        { return p.p.FileInfo() }
+
+func TestDiffHighlight(t *testing.T) {
+	diff := `--- a/main.go
++++ b/main.go
+@@ -1,3 +1,3 @@
+ package main
+-var x = 1
++var x = 2 // <changed>
+--- a comment removed
++++ counter
+diff --git a/go.mod b/go.mod
+--- a/go.mod
++++ b/go.mod
+`
+	exp := `<pre class="diff"><code><span class="diff-file">--- a/main.go</span>
+<span class="diff-file">+++ b/main.go</span>
+<span class="diff-hunk">@@ -1,3 +1,3 @@</span>
+ package main
+<span class="diff-del">-var x = 1</span>
+<span class="diff-add">+var x = 2 // &lt;changed&gt;</span>
+<span class="diff-del">--- a comment removed</span>
+<span class="diff-add">+++ counter</span>
+diff --git a/go.mod b/go.mod
+<span class="diff-file">--- a/go.mod</span>
+<span class="diff-file">+++ b/go.mod</span></code></pre>`
+	if out := diffHighlight(diff); out != exp {
+		t.Errorf("expected\n%s\ngot\n%s", exp, out)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	in := `Go is an open source programming language that makes it easy to build simple, reliable, and efficient software.
+
+Second paragraph.`
+	exp := `Go is an open source programming
+language that makes it easy to build
+simple, reliable, and efficient
+software.
+
+Second paragraph.`
+	if out := wrap(40, in); out != exp {
+		t.Errorf("expected\n%s\ngot\n%s", exp, out)
+	}
+	in = "see https://example.com/a/very/long/path/to/some/page for details"
+	exp = "see\nhttps://example.com/a/very/long/path/to/some/page\nfor details"
+	if out := wrap(20, in); out != exp {
+		t.Errorf("expected\n%s\ngot\n%s", exp, out)
+	}
+}
+
+func TestQR(t *testing.T) {
+	c := newTestCollection()
+	c.SetBaseURL("http://example.com")
+	if _, err := c.qr("/a/"); err == nil {
+		t.Errorf("expected error without QR function")
+	}
+	c.SetQRFunc(func(data string) ([]byte, error) {
+		return []byte("QR:" + data), nil
+	})
+	out := renderString(t, c, `<img src="{{qr "/a/"}}">`)
+	if exp := `<img src="data:image/png;base64,UVI6aHR0cDovL2V4YW1wbGUuY29tL2Ev">`; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+}
+
+func TestSeriesNav(t *testing.T) {
+	part := func(url string, order int) map[string]interface{} {
+		return map[string]interface{}{"url": url, "series": "tutorial", "series_order": order}
+	}
+	pages := []map[string]interface{}{
+		part("/part3/", 3),
+		{"url": "/other/"},
+		part("/part1/", 1),
+		part("/part2/", 2),
+	}
+	nav, err := seriesNav(pages[3], pages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var urls []string
+	for _, p := range nav.Parts {
+		urls = append(urls, p.(map[string]interface{})["url"].(string))
+	}
+	if out, exp := strings.Join(urls, " "), "/part1/ /part2/ /part3/"; out != exp {
+		t.Errorf("expected parts %q, got %q", exp, out)
+	}
+	if nav.Index != 1 || nav.Number != 2 || nav.Total != 3 {
+		t.Errorf("expected part 2 of 3, got index %d, number %d, total %d", nav.Index, nav.Number, nav.Total)
+	}
+	if nav.Prev == nil || nav.Prev.(map[string]interface{})["url"] != "/part1/" ||
+		nav.Next == nil || nav.Next.(map[string]interface{})["url"] != "/part3/" {
+		t.Errorf("unexpected prev %v or next %v", nav.Prev, nav.Next)
+	}
+	nav, err = seriesNav(pages[1], pages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nav != nil {
+		t.Errorf("expected nil for page without series, got %v", nav)
+	}
+}
+
+func TestSemver(t *testing.T) {
+	c := newTestCollection()
+	var tests = []struct {
+		a, b string
+		n    int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"v1.2.3", "1.2.3", 0},
+		{"1.2.3", "1.10.0", -1},
+		{"2.0.0", "1.99.99", 1},
+		{"1.0.0-beta", "1.0.0", -1},
+		{"1.0.0", "1.0.0-rc.1", 1},
+		{"1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{"1.0.0-rc.2", "1.0.0-rc.10", -1},
+		{"1.0.0+build.5", "1.0.0", 0},
+		{"1.2", "1.2.0", 0},
+	}
+	for _, v := range tests {
+		n, err := c.semverCompare(v.a, v.b)
+		if err != nil {
+			t.Fatalf("%s, %s: %s", v.a, v.b, err)
+		}
+		if n != v.n {
+			t.Errorf("%s, %s: expected %d, got %d", v.a, v.b, v.n, n)
+		}
+	}
+
+	list := []interface{}{"1.0.0", "nightly", "2.0.0-rc.1", "1.10.0", "v1.9.2", "2.0.0"}
+	sorted, err := c.semverSort(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, exp := strings.Join(sorted, " "), "2.0.0 2.0.0-rc.1 1.10.0 v1.9.2 1.0.0 nightly"; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+	latest, err := c.semverLatest(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest != "2.0.0" {
+		t.Errorf("expected latest 2.0.0, got %q", latest)
+	}
+
+	c.SetStrictSemver(true)
+	if _, err := c.semverSort(list); err == nil {
+		t.Errorf("expected error for invalid version in strict mode")
+	}
+	if _, err := c.semverCompare("1.0", "x"); err == nil {
+		t.Errorf("expected error for invalid version in strict mode")
+	}
+}
+
+func TestOutputLinks(t *testing.T) {
+	c := newTestCollection()
+	c.SetBaseURL("http://example.com")
+	page := &testPage{
+		meta:    map[string]interface{}{"outputs": []interface{}{"html", "amp"}},
+		url:     "/about/",
+		content: `{{range outputLinks .Page}}{{if ne .Format "html"}}<link rel="{{.Rel}}" href="{{.URL}}">{{end}}{{end}}`,
+	}
+	// .Page is meta, which has no url, so set it.
+	page.meta["url"] = page.url
+	out, err := c.RenderPage(page, "none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := `<link rel="amphtml" href="http://example.com/amp/about/">`; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+	links, err := c.outputLinks(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []OutputLink{
+		{"html", "http://example.com/about/", "text/html", "canonical"},
+		{"amp", "http://example.com/amp/about/", "text/html", "amphtml"},
+	}
+	if !reflect.DeepEqual(links, exp) {
+		t.Errorf("expected %v, got %v", exp, links)
+	}
+	if links, err := c.outputLinks(&testPage{url: "/x/"}); err != nil || links != nil {
+		t.Errorf("expected no links for page without outputs, got %v, %v", links, err)
+	}
+	var tests = []struct{ url, json string }{
+		{"/about/", "http://example.com/about/index.json"},
+		{"/", "http://example.com/index.json"},
+		{"/foo.html", "http://example.com/foo.json"},
+		{"/blog/post", "http://example.com/blog/post.json"},
+	}
+	for _, v := range tests {
+		links, err := c.outputLinks(&testPage{url: v.url, meta: map[string]interface{}{"outputs": "json"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(links) != 1 || links[0].URL != v.json {
+			t.Errorf("%s: expected %q, got %v", v.url, v.json, links)
+		}
+	}
+}
+
+func TestFirstParagraph(t *testing.T) {
+	var tests = []struct {
+		in, out string
+	}{
+		{"<h1>Title</h1>\n<p class=\"lead\">First <em>one</em>.</p>\n<p>Second.</p>", "First <em>one</em>."},
+		{"# Title\n\nFirst line\nof text.\n\nSecond.", "First line\nof text."},
+		{"Title\n=====\n\nIntro.", "Intro."},
+		{"Just text.", "Just text."},
+		{"", ""},
+	}
+	for i, v := range tests {
+		if out := firstParagraph(v.in); out != v.out {
+			t.Errorf("%d: expected %q, got %q", i, v.out, out)
+		}
+	}
+}
+
+func TestChromeMeta(t *testing.T) {
+	c := newTestCollection()
+	c.SetChromeConfig(ChromeConfig{
+		ThemeColor:     "#336699",
+		Favicon:        "/favicon.ico",
+		AppleTouchIcon: "/apple-touch-icon.png",
+		Manifest:       "/site.webmanifest",
+	})
+	exp := `<meta name="theme-color" content="#336699">
+<link rel="icon" href="/favicon.ico">
+<link rel="apple-touch-icon" href="/apple-touch-icon.png">
+<link rel="manifest" href="/site.webmanifest">
+`
+	if out := c.chromeMeta(nil); out != exp {
+		t.Errorf("full: expected\n%s\ngot\n%s", exp, out)
+	}
+
+	c.SetChromeConfig(ChromeConfig{Favicon: "/favicon.png"})
+	site := map[string]interface{}{"theme_color": "white"}
+	exp = `<meta name="theme-color" content="white">
+<link rel="icon" href="/favicon.png">
+`
+	if out := c.chromeMeta(site); out != exp {
+		t.Errorf("partial: expected\n%s\ngot\n%s", exp, out)
+	}
+	c.SetChromeConfig(ChromeConfig{})
+	if out := c.chromeMeta(nil); out != "" {
+		t.Errorf("empty: expected no output, got %q", out)
+	}
+}
+
+func TestJSEscape(t *testing.T) {
+	in := "He said \"it's\" \\ </script><script>alert(1)\u2028next\u2029"
+	exp := `He said \"it\'s\" \\ \u003C/script\u003E\u003Cscript\u003Ealert(1)\u2028next\u2029`
+	if out := jsEscape(in); out != exp {
+		t.Errorf("expected\n%s\ngot\n%s", exp, out)
+	}
+	c := newTestCollection()
+	out := renderString(t, c, `<script>var title = "{{jsEscape "a\"b</script>"}}";</script>`)
+	if exp := `<script>var title = "a\"b\u003C/script\u003E";</script>`; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+}
+
+func TestLastUpdated(t *testing.T) {
+	c := newTestCollection()
+	var tests = []struct {
+		meta map[string]interface{}
+		out  string
+	}{
+		{map[string]interface{}{"date": "2016-01-02", "lastmod": "2016-03-04"}, "Last updated on March 4, 2016"},
+		{map[string]interface{}{"date": time.Date(2016, 1, 2, 0, 0, 0, 0, time.UTC)}, "Last updated on January 2, 2016"},
+		{map[string]interface{}{}, ""},
+	}
+	for i, v := range tests {
+		out, err := c.lastUpdated(nil, v.meta)
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		if out != v.out {
+			t.Errorf("%d: expected %q, got %q", i, v.out, out)
+		}
+	}
+	c.SetDateLayout("2006-01-02")
+	c.SetStrictTranslations(true)
+	c.SetTranslations("en", map[string]string{"title": "Title"})
+	out := renderString(t, c, `{{lastUpdated (dict "lastmod" "2016-03-04")}}`)
+	if exp := "Last updated on 2016-03-04"; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+	c.SetTranslations("en", map[string]string{LastUpdatedKey: "Updated: %s"})
+	out = renderString(t, c, `{{lastUpdated (dict "lastmod" "2016-03-04")}}`)
+	if exp := "Updated: 2016-03-04"; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+}
+
+func TestBetween(t *testing.T) {
+	c := newTestCollection()
+	var tests = []struct {
+		now        string
+		start, end interface{}
+		out        bool
+	}{
+		{"2024-11-30", "2024-12-01", "2024-12-26", false},
+		{"2024-12-01", "2024-12-01", "2024-12-26", true},
+		{"2024-12-15", "2024-12-01", "2024-12-26", true},
+		{"2024-12-26", "2024-12-01", "2024-12-26", true},
+		{"2024-12-26 12:00", "2024-12-01", "2024-12-26", true},
+		{"2024-12-27", "2024-12-01", "2024-12-26", false},
+		{"2024-12-26 12:00", "2024-12-01", "2024-12-26 12:00", false},
+		{"2025-01-01", "2024-12-01", "", true},
+		{"2024-11-01", "2024-12-01", "", false},
+		{"2020-01-01", "", "2024-12-26", true},
+		{"2025-01-01", "", "2024-12-26", false},
+		{"2025-01-01", "", "", true},
+		{"2024-12-15", time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC), nil, true},
+	}
+	for i, v := range tests {
+		now, err := utils.ParseAnyDate(v.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.SetNow(func() time.Time { return now })
+		out, err := c.between(v.start, v.end)
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		if out != v.out {
+			t.Errorf("%d: expected %v, got %v", i, v.out, out)
+		}
+	}
+	if _, err := c.between("tomorrow", ""); err == nil {
+		t.Errorf("expected error for invalid date")
+	}
+	c.SetNow(func() time.Time { return time.Date(2024, 12, 24, 12, 0, 0, 0, time.UTC) })
+	out := renderString(t, c, `{{if between "2024-12-01" "2024-12-26"}}sale{{end}}`)
+	if out != "sale" {
+		t.Errorf("expected %q, got %q", "sale", out)
+	}
+}
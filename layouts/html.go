@@ -0,0 +1,317 @@
+// Copyright 2013 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package layouts
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/shurcooL/sanitized_anchor_name"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// transformText calls f for each text outside of the given elements
+// in HTML and replaces the text with the result. Text is passed and
+// returned in its raw (escaped) form.
+func transformText(in string, skip []atom.Atom, f func(raw string) string) (string, error) {
+	return transformTokens(in, skip, func(tt html.TokenType, a atom.Atom, raw string, skipped bool) string {
+		if tt == html.TextToken && !skipped {
+			return f(raw)
+		}
+		return raw
+	})
+}
+
+// transformTokens calls f for each token in HTML with its type, atom
+// of tag name, raw form, and whether it's inside of the given elements,
+// and replaces the token with the result.
+func transformTokens(in string, skip []atom.Atom, f func(tt html.TokenType, a atom.Atom, raw string, skipped bool) string) (string, error) {
+	var buf bytes.Buffer
+	z := html.NewTokenizer(strings.NewReader(in))
+	depth := make(map[atom.Atom]int)
+	isSkipped := func() bool {
+		for _, a := range skip {
+			if depth[a] > 0 {
+				return true
+			}
+		}
+		return false
+	}
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if err := z.Err(); err != io.EOF {
+				return "", err
+			}
+			return buf.String(), nil
+		}
+		raw := string(z.Raw())
+		var a atom.Atom
+		switch tt {
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			a = atom.Lookup(name)
+			if tt == html.SelfClosingTagToken {
+				break
+			}
+			for _, s := range skip {
+				if a == s {
+					if tt == html.StartTagToken {
+						depth[a]++
+					} else if depth[a] > 0 {
+						depth[a]--
+					}
+				}
+			}
+		}
+		buf.WriteString(f(tt, a, raw, isSkipped()))
+	}
+}
+
+// rewriteURLs calls f for values of src and href attributes
+// in HTML and replaces them with the results.
+func rewriteURLs(in string, f func(url string) string) (string, error) {
+	var buf bytes.Buffer
+	z := html.NewTokenizer(strings.NewReader(in))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if err := z.Err(); err != io.EOF {
+				return "", err
+			}
+			return buf.String(), nil
+		}
+		raw := z.Raw()
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			buf.Write(raw)
+			continue
+		}
+		// Copy raw bytes, since Token() may overwrite them.
+		raw = append([]byte(nil), raw...)
+		tok := z.Token()
+		changed := false
+		for i, a := range tok.Attr {
+			if a.Namespace != "" || (a.Key != "src" && a.Key != "href") {
+				continue
+			}
+			if v := f(a.Val); v != a.Val {
+				tok.Attr[i].Val = v
+				changed = true
+			}
+		}
+		if !changed {
+			buf.Write(raw)
+			continue
+		}
+		buf.WriteString(tok.String())
+	}
+}
+
+var bareURLRx = regexp.MustCompile(`https?://[^\s<>"']+`)
+
+// linkify wraps bare URLs in HTML text into links.
+// URLs inside links, code, and pre elements are left untouched.
+func linkify(s string) (string, error) {
+	return transformText(s, []atom.Atom{atom.A, atom.Code, atom.Pre, atom.Script, atom.Style}, func(raw string) string {
+		return bareURLRx.ReplaceAllStringFunc(raw, func(u string) string {
+			// Don't include trailing punctuation into URL.
+			trimmed := strings.TrimRight(u, ".,;:!?)")
+			return `<a href="` + trimmed + `">` + trimmed + `</a>` + u[len(trimmed):]
+		})
+	})
+}
+
+// anchorize returns anchor name for text, the same
+// as used for ids of headings in Markdown.
+func anchorize(text string) string {
+	return sanitized_anchor_name.Create(text)
+}
+
+// addHeadingAnchors adds ids made from text to h2-h4 headings
+// without them and appends links to these ids to headings.
+// Duplicate ids get numeric suffixes.
+func addHeadingAnchors(in string) (string, error) {
+	var buf bytes.Buffer
+	z := html.NewTokenizer(strings.NewReader(in))
+	used := make(map[string]bool)
+	// Collect existing ids first to avoid generating the same.
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		if tt == html.StartTagToken || tt == html.SelfClosingTagToken {
+			for _, a := range z.Token().Attr {
+				if a.Key == "id" {
+					used[a.Val] = true
+				}
+			}
+		}
+	}
+	z = html.NewTokenizer(strings.NewReader(in))
+	var (
+		heading *html.Token  // current heading start tag
+		inner   bytes.Buffer // raw heading content
+		text    bytes.Buffer // heading text
+	)
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if err := z.Err(); err != io.EOF {
+				return "", err
+			}
+			if heading != nil {
+				// Unclosed heading.
+				buf.WriteString(heading.String())
+				buf.Write(inner.Bytes())
+			}
+			return buf.String(), nil
+		}
+		raw := append([]byte(nil), z.Raw()...)
+		if heading == nil {
+			if tt == html.StartTagToken {
+				tok := z.Token()
+				switch tok.DataAtom {
+				case atom.H2, atom.H3, atom.H4:
+					heading = &tok
+					inner.Reset()
+					text.Reset()
+					continue
+				}
+			}
+			buf.Write(raw)
+			continue
+		}
+		if tt == html.EndTagToken {
+			if name, _ := z.TagName(); atom.Lookup(name) == heading.DataAtom {
+				id := ""
+				for _, a := range heading.Attr {
+					if a.Key == "id" {
+						id = a.Val
+					}
+				}
+				if id == "" {
+					id = uniqueID(anchorize(text.String()), used)
+					if id != "" {
+						heading.Attr = append(heading.Attr, html.Attribute{Key: "id", Val: id})
+					}
+				}
+				buf.WriteString(heading.String())
+				buf.Write(inner.Bytes())
+				if id != "" {
+					fmt.Fprintf(&buf, `<a class="anchor" href="#%s">#</a>`, html.EscapeString(id))
+				}
+				buf.Write(raw)
+				heading = nil
+				continue
+			}
+		}
+		if tt == html.TextToken {
+			text.WriteString(html.UnescapeString(string(raw)))
+		}
+		inner.Write(raw)
+	}
+}
+
+// uniqueID returns id, adding numeric suffix to it
+// if it's already used, and marks the result as used.
+func uniqueID(id string, used map[string]bool) string {
+	if id == "" {
+		return ""
+	}
+	unique := id
+	for i := 1; used[unique]; i++ {
+		unique = fmt.Sprintf("%s-%d", id, i)
+	}
+	used[unique] = true
+	return unique
+}
+
+// typographySkip are elements, which text is not changed by typographer.
+var typographySkip = []atom.Atom{atom.Code, atom.Pre, atom.Kbd, atom.Script, atom.Style, atom.Textarea}
+
+// blockElements are elements, which start and end
+// text for typographer, such as quoted sentences.
+var blockElements = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Aside: true, atom.Blockquote: true,
+	atom.Body: true, atom.Br: true, atom.Caption: true, atom.Dd: true, atom.Div: true,
+	atom.Dl: true, atom.Dt: true, atom.Figcaption: true, atom.Figure: true,
+	atom.Footer: true, atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true,
+	atom.H5: true, atom.H6: true, atom.Header: true, atom.Hr: true, atom.Li: true,
+	atom.Nav: true, atom.Ol: true, atom.P: true, atom.Pre: true,
+	atom.Section: true, atom.Table: true, atom.Td: true, atom.Th: true,
+	atom.Title: true, atom.Tr: true, atom.Ul: true,
+}
+
+var textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// typeset applies typographer f to text of HTML outside of typographySkip
+// elements. Text is unescaped before calling f and escaped after it.
+// Text is passed along with the last character of preceding text in
+// the same block, so that f can tell, for example, whether a quote
+// after an inline element is closing.
+func typeset(in string, f func(text string) string) (string, error) {
+	prev := "" // last character of preceding text in block
+	return transformTokens(in, typographySkip, func(tt html.TokenType, a atom.Atom, raw string, skipped bool) string {
+		if tt != html.TextToken {
+			if blockElements[a] {
+				prev = ""
+			}
+			return raw
+		}
+		text := html.UnescapeString(raw)
+		if text == "" {
+			return raw
+		}
+		out := raw
+		if !skipped {
+			t := f(prev + text)
+			if p := f(prev); strings.HasPrefix(t, p) {
+				t = t[len(p):]
+			} else {
+				t = f(text)
+			}
+			if t != text {
+				out = textEscaper.Replace(t)
+			}
+		}
+		_, n := utf8.DecodeLastRuneInString(text)
+		prev = text[len(text)-n:]
+		return out
+	})
+}
+
+var smartyReplacer = strings.NewReplacer("---", "\u2014", "--", "\u2013", "...", "\u2026")
+
+// SmartyPants returns text with straight quotes replaced with curly ones,
+// "--" and "---" with en and em dashes, and "..." with ellipsis.
+// It can be used as typographer.
+func SmartyPants(text string) string {
+	text = smartyReplacer.Replace(text)
+	var buf bytes.Buffer
+	prev := ' '
+	for _, r := range text {
+		opening := strings.ContainsRune(" \t\r\n([{\u2013\u2014", prev)
+		switch {
+		case r == '"' && opening:
+			buf.WriteRune('\u201c')
+		case r == '"':
+			buf.WriteRune('\u201d')
+		case r == '\'' && opening:
+			buf.WriteRune('\u2018')
+		case r == '\'':
+			buf.WriteRune('\u2019')
+		default:
+			buf.WriteRune(r)
+		}
+		prev = r
+	}
+	return buf.String()
+}
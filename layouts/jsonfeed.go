@@ -0,0 +1,146 @@
+// Copyright 2013 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package layouts
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// JSONFeedVersion is the version of JSON Feed format.
+const JSONFeedVersion = "https://jsonfeed.org/version/1"
+
+type jsonFeed struct {
+	Version     string          `json:"version"`
+	Title       string          `json:"title"`
+	HomePageURL string          `json:"home_page_url,omitempty"`
+	FeedURL     string          `json:"feed_url,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Items       []*jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string `json:"id"`
+	URL           string `json:"url"`
+	Title         string `json:"title,omitempty"`
+	ContentHTML   string `json:"content_html"`
+	DatePublished string `json:"date_published,omitempty"`
+}
+
+// siteField returns string value of the given key of site data, which
+// can be a map or a struct with the key or field named as key ignoring case.
+func siteField(site interface{}, key string) string {
+	if m, ok := stringMap(site); ok {
+		v, ok := m[key]
+		if !ok {
+			// Match key case-insensitively, like struct fields.
+			names := make([]string, 0, len(m))
+			for k := range m {
+				names = append(names, k)
+			}
+			sort.Strings(names)
+			for _, k := range names {
+				if strings.EqualFold(k, key) {
+					v = m[k]
+					break
+				}
+			}
+		}
+		if v != nil {
+			return fmt.Sprint(v)
+		}
+		return ""
+	}
+	v := reflect.ValueOf(site)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+	f := v.FieldByNameFunc(func(name string) bool {
+		return strings.EqualFold(name, key)
+	})
+	if !f.IsValid() || f.Kind() != reflect.String {
+		return ""
+	}
+	return f.String()
+}
+
+// jsonfeed returns JSON Feed made from site and posts. Feed title and
+// home page URL are taken from site `name` (or `title`) and `url`, and
+// can be overridden with options map having `title`, `home_page_url`,
+// `feed_url`, and `description` keys.
+func (c *Collection) jsonfeed(site, posts interface{}, opts ...map[string]interface{}) (string, error) {
+	if len(opts) > 1 {
+		return "", fmt.Errorf("jsonfeed: too many arguments")
+	}
+	feed := &jsonFeed{
+		Version:     JSONFeedVersion,
+		Title:       siteField(site, "name"),
+		HomePageURL: siteField(site, "url"),
+		Items:       make([]*jsonFeedItem, 0),
+	}
+	if feed.Title == "" {
+		feed.Title = siteField(site, "title")
+	}
+	if len(opts) > 0 {
+		for k, v := range opts[0] {
+			s := fmt.Sprint(v)
+			switch k {
+			case "title":
+				feed.Title = s
+			case "home_page_url":
+				feed.HomePageURL = s
+			case "feed_url":
+				feed.FeedURL = c.absURL(s)
+			case "description":
+				feed.Description = s
+			default:
+				return "", fmt.Errorf("jsonfeed: unknown option %q", k)
+			}
+		}
+	}
+	list, err := listOf(posts)
+	if err != nil {
+		return "", fmt.Errorf("jsonfeed: %s", err)
+	}
+	for _, p := range list {
+		meta, err := metaOf(p)
+		if err != nil {
+			return "", fmt.Errorf("jsonfeed: %s", err)
+		}
+		u, err := pageURL(p)
+		if err != nil {
+			return "", fmt.Errorf("jsonfeed: %s", err)
+		}
+		item := &jsonFeedItem{
+			ID:  c.absURL(u),
+			URL: c.absURL(u),
+		}
+		item.Title, _ = meta["title"].(string)
+		if pc, ok := p.(PageContext); ok {
+			item.ContentHTML = pc.Content()
+		}
+		date, ok, err := metaDate(meta, "date")
+		if err != nil {
+			return "", fmt.Errorf("jsonfeed: %s", err)
+		}
+		if ok {
+			item.DatePublished = date.Format(time.RFC3339)
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	// Marshal escapes <, >, and &, so that content is safe.
+	b, err := json.Marshal(feed)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
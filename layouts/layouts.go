@@ -7,14 +7,25 @@ package layouts
 
 import (
 	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"log"
+	"mime"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 	"sync"
 	"text/template"
+	"time"
+	"unicode/utf8"
 
 	"github.com/dchest/kkr/metafile"
+	"github.com/dchest/kkr/utils"
 )
 
 type FuncMap template.FuncMap
@@ -31,27 +42,541 @@ type PageContext interface {
 	FileInfo() os.FileInfo
 }
 
+// sourcePath returns path of source file of page if it has
+// SourcePath() string method, or an empty string.
+func sourcePath(p PageContext) string {
+	if s, ok := p.(interface {
+		SourcePath() string
+	}); ok {
+		return s.SourcePath()
+	}
+	return ""
+}
+
 // Layout represends a layout.
 type Layout struct {
 	Name       string
 	ParentName string
 	Template   *template.Template
+	Filename   string // source file, if loaded from file
+	NoCache    bool   // pages using layout are not cached
 }
 
+// FinalNewlinePolicy determines how newlines at
+// the end of rendered pages are handled.
+type FinalNewlinePolicy int
+
+const (
+	PreserveFinalNewline FinalNewlinePolicy = iota // leave output as is
+	AddFinalNewline                                // end output with exactly one newline
+	StripFinalNewline                              // remove all newlines at the end
+)
+
 type Collection struct {
-	layouts map[string]*Layout
-	context SiteContext
+	layouts  map[string]*Layout
+	includes map[string]string
+	fallback *Collection // where to look for missing includes
+	context  SiteContext
+	now      func() time.Time
+
+	linked       map[string]*Collection // collections for `includeFrom`
+	placeholders map[string]string      // placeholder name -> include name
+
+	baseURL         string
+	translationsMap func(url string) map[string]string
+	pageResolver    func(url string) (PageContext, error)
+
+	// mu protects records, warnings, tmplCache, container, and
+	// sourceHash, which are modified when rendering pages concurrently.
+	mu      sync.Mutex
+	records map[string]*renderRecord
+
+	defaultLocale      string
+	translations       map[string]map[string]string
+	strictTranslations bool
+
+	permalinkPattern string
+	dateLayout       string
+	uglyURLs         bool
+
+	tmplCache map[string]*template.Template // compiled `tmpl` templates
+
+	pipeline       []Stage
+	renderObserver func(PageContext, *RenderResult)
+	metricsMu      sync.Mutex
+	metrics        map[string]LayoutMetric
+	assetRewriter  func(path string) string
+	postProcessors map[string]func([]byte) ([]byte, error)
+	headingAnchors bool
+	typographer    func(text string) string
+	emptyBody      string // content used for pages with empty body
+	vcsInfo        *VCSInfo
+	siteStats      map[string]interface{}
+	buildID        string
+	sourceHash     string // cached build identifier made from sources
+	exposeBuildID  bool
+	debugConfig    bool
+	consentChecker func(category string) bool
+	finalNewline   FinalNewlinePolicy
+	maxLayoutDepth int
+
+	extendsConflict ExtendsConflictPolicy
+	implicitParent  string
+	colorPalette    []string
+	seed            int64
+	chrome          ChromeConfig
+	outputFormats   map[string]OutputFormat
+	strictSemver    bool
+	container       *template.Template
+	undatedLabel    string
+	sanitizer       func(html string) string
+	kvtableFlat     bool
+	divByZeroError  bool
+
+	wordsPerMinute int
+	summaryWords   int
+
+	shortWords int // maximum number of words in short content
+	longWords  int // minimum number of words in long content
+
+	layoutByLength map[string]int // layout name => minimum number of words
+
+	autoDescription    bool
+	autoDescriptionLen int
+
+	devMode               bool
+	draftWatermark        string // HTML added to drafts in dev mode
+	missingPartialComment bool
+	recoverPanics         bool
+
+	qrFunc         func(data string) ([]byte, error)
+	dataURIRoot    string
+	dataURIMaxSize int64
+
+	knownURLs   map[string]bool
+	strictLinks bool
+
+	warnings        []Warning
+	deprecatedFuncs map[string]string
 }
 
 func NewCollection(context SiteContext) *Collection {
 	return &Collection{
-		layouts: make(map[string]*Layout),
-		context: context,
+		layouts:        make(map[string]*Layout),
+		includes:       make(map[string]string),
+		records:        make(map[string]*renderRecord),
+		linked:         make(map[string]*Collection),
+		placeholders:   make(map[string]string),
+		postProcessors: make(map[string]func([]byte) ([]byte, error)),
+		metrics:        make(map[string]LayoutMetric),
+		tmplCache:      make(map[string]*template.Template),
+		context:        context,
+		now:            time.Now,
+
+		pipeline:       DefaultPipeline,
+		dataURIMaxSize: DefaultDataURIMaxSize,
+		maxLayoutDepth: DefaultMaxLayoutDepth,
+		undatedLabel:   DefaultUndatedLabel,
+		wordsPerMinute: DefaultWordsPerMinute,
+		summaryWords:   DefaultSummaryWords,
+		shortWords:     DefaultShortWords,
+		longWords:      DefaultLongWords,
+		defaultLocale:  DefaultLocale,
+		dateLayout:     DefaultDateLayout,
+		translations:   make(map[string]map[string]string),
+	}
+}
+
+// AddInclude adds include text, which is returned
+// by `include` template function, under the given name.
+func (c *Collection) AddInclude(name, content string) {
+	c.includes[name] = content
+	c.resetSourceHash()
+}
+
+// SetBaseURL sets site URL, which is prepended to
+// paths when making absolute URLs.
+func (c *Collection) SetBaseURL(url string) {
+	c.baseURL = strings.TrimSuffix(url, "/")
+}
+
+// SetTranslationsMap sets the function returning URLs of translations
+// of the page with the given URL addressed by locale names.
+func (c *Collection) SetTranslationsMap(f func(url string) map[string]string) {
+	c.translationsMap = f
+}
+
+// SetPageResolver sets the function returning page by its URL,
+// which is used by `renderPageByURL` template function.
+func (c *Collection) SetPageResolver(f func(url string) (PageContext, error)) {
+	c.pageResolver = f
+}
+
+// SetPermalinkPattern sets pattern used by `permalink` template function.
+// Pattern may contain :year, :month, :day, :slug, :category,
+// and :title placeholders filled from page meta.
+func (c *Collection) SetPermalinkPattern(pattern string) {
+	c.permalinkPattern = pattern
+}
+
+// SetPrettyURLs sets policy used by OutputPath for URLs without file
+// extensions. With pretty URLs (default), "/about/" is written to
+// "about/index.html", otherwise to "about.html".
+func (c *Collection) SetPrettyURLs(pretty bool) {
+	c.uglyURLs = !pretty
+}
+
+// OutputPath returns path of output file, relative to output
+// directory, for page with the given URL.
+func (c *Collection) OutputPath(url string) string {
+	if i := strings.IndexAny(url, "?#"); i >= 0 {
+		url = url[:i]
+	}
+	p := strings.TrimPrefix(path.Clean("/"+url), "/")
+	switch {
+	case p == "":
+		p = "index.html"
+	case path.Ext(p) != "":
+		// keep as is
+	case c.uglyURLs:
+		p += ".html"
+	default:
+		p += "/index.html"
+	}
+	return filepath.FromSlash(p)
+}
+
+// DefaultDateLayout is the default layout of dates formatted by collection.
+const DefaultDateLayout = "January 2, 2006"
+
+// SetDateLayout sets layout (as in time.Format) of dates
+// formatted by template functions, such as `lastUpdated`.
+func (c *Collection) SetDateLayout(layout string) {
+	c.dateLayout = layout
+}
+
+// SetSanitizer sets the function used by `sanitize` template function
+// to sanitize untrusted HTML. If sanitizer is nil, `sanitize` escapes HTML.
+func (c *Collection) SetSanitizer(f func(html string) string) {
+	c.sanitizer = f
+}
+
+// DefaultContainerTemplate is the default template for `container`.
+const DefaultContainerTemplate = `<div class="container{{with .Options.class}} {{.}}{{end}}">{{.Content}}</div>`
+
+// SetContainerTemplate sets template used by `container` template
+// function to wrap content. The template is executed with .Content
+// and .Options, which is a map of options passed to `container`.
+func (c *Collection) SetContainerTemplate(s string) error {
+	t, err := template.New("container").Funcs(c.funcs(nil)).Parse(s)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.container = t
+	c.mu.Unlock()
+	return nil
+}
+
+// SetKVTableFlatten sets whether `kvtable` template function flattens
+// nested maps into rows with dotted keys, such as "a.b", instead of
+// rendering them as nested tables.
+func (c *Collection) SetKVTableFlatten(flat bool) {
+	c.kvtableFlat = flat
+}
+
+// SetDivisionByZeroError sets whether `percent` and `ratio` template
+// functions return an error when dividing by zero instead of zero.
+func (c *Collection) SetDivisionByZeroError(value bool) {
+	c.divByZeroError = value
+}
+
+// DefaultDataURIMaxSize is the default maximum size of file for `datauri`.
+const DefaultDataURIMaxSize = 8192
+
+// SetDataURIRoot sets directory from which `datauri` template function
+// reads files and the maximum size of these files in bytes.
+func (c *Collection) SetDataURIRoot(dir string, maxSize int64) {
+	c.dataURIRoot = dir
+	c.dataURIMaxSize = maxSize
+}
+
+// SetQRFunc sets the function returning PNG image
+// of QR code for data, which is used by `qr` template function.
+func (c *Collection) SetQRFunc(f func(data string) ([]byte, error)) {
+	c.qrFunc = f
+}
+
+// SetConsentChecker sets the function reporting whether scripts of the
+// given consent category, such as "analytics", are allowed. Without
+// checker, `consentScript` template function renders only placeholders.
+func (c *Collection) SetConsentChecker(f func(category string) bool) {
+	c.consentChecker = f
+}
+
+// SetSeed sets seed used by `sample` template function.
+// Using the same seed makes builds reproducible.
+func (c *Collection) SetSeed(seed int64) {
+	c.seed = seed
+}
+
+// ChromeConfig describes browser chrome of site for `chromeMeta`.
+type ChromeConfig struct {
+	ThemeColor     string // e.g. "#336699"
+	Favicon        string // URL of favicon
+	AppleTouchIcon string // URL of icon for iOS home screen
+	Manifest       string // URL of web app manifest
+}
+
+// SetChromeConfig sets configuration used by `chromeMeta` template function.
+func (c *Collection) SetChromeConfig(config ChromeConfig) {
+	c.chrome = config
+}
+
+// SetColorPalette sets colors from which `colorFrom` template function
+// picks. If palette is empty, `colorFrom` returns arbitrary colors.
+func (c *Collection) SetColorPalette(palette []string) {
+	c.colorPalette = palette
+}
+
+// SetAssetRewriter sets the function which rewrites local paths
+// (starting with a single slash) in src and href attributes of
+// rendered HTML pages, for example, to point them to CDN.
+func (c *Collection) SetAssetRewriter(f func(path string) string) {
+	c.assetRewriter = f
+}
+
+// SetHeadingAnchors sets whether h2-h4 headings of rendered HTML pages
+// get anchor links to themselves. Headings without ids get them
+// generated from their text like with `anchorize` template function.
+func (c *Collection) SetHeadingAnchors(enabled bool) {
+	c.headingAnchors = enabled
+}
+
+// SetEmptyBodyFallback sets content used instead of
+// content of pages with empty or whitespace-only body.
+func (c *Collection) SetEmptyBodyFallback(s string) {
+	c.emptyBody = s
+}
+
+// SetPostProcessor sets the function which processes output of pages,
+// whose outermost layout (or URL if there's no layout file) has the
+// given extension, such as ".html". If f is nil, processor is removed.
+func (c *Collection) SetPostProcessor(ext string, f func([]byte) ([]byte, error)) {
+	if f == nil {
+		delete(c.postProcessors, ext)
+		return
+	}
+	c.postProcessors[ext] = f
+}
+
+// SetTypographer sets the function applied to text of rendered HTML
+// pages outside of code, pre, kbd, script, style, and textarea elements,
+// such as SmartyPants. Text is passed unescaped, and the result is
+// escaped again.
+func (c *Collection) SetTypographer(f func(text string) string) {
+	c.typographer = f
+}
+
+// SetRenderObserver sets the function called
+// with results of RenderPageResult.
+func (c *Collection) SetRenderObserver(f func(PageContext, *RenderResult)) {
+	c.renderObserver = f
+}
+
+// DefaultMaxLayoutDepth is the default maximum number of parent layouts.
+const DefaultMaxLayoutDepth = 20
+
+// SetMaxLayoutDepth sets the maximum number of layouts in
+// chain of parents of a page. Deeper chains cause rendering error.
+func (c *Collection) SetMaxLayoutDepth(n int) {
+	c.maxLayoutDepth = n
+}
+
+// SetFinalNewline sets policy for newlines at the end of rendered pages.
+func (c *Collection) SetFinalNewline(policy FinalNewlinePolicy) {
+	c.finalNewline = policy
+}
+
+// DefaultSummaryWords is the default number of words in automatic summary.
+const DefaultSummaryWords = 50
+
+// SetSummaryWords sets the number of words in summaries made by
+// `summaryOf` template function for pages without <!--more--> marker.
+func (c *Collection) SetSummaryWords(n int) {
+	c.summaryWords = n
+}
+
+// DefaultWordsPerMinute is the default reading speed.
+const DefaultWordsPerMinute = 200
+
+// SetWordsPerMinute sets reading speed used to estimate reading time.
+func (c *Collection) SetWordsPerMinute(n int) {
+	c.wordsPerMinute = n
+}
+
+// Default thresholds for `lengthClass` template function.
+const (
+	DefaultShortWords = 300
+	DefaultLongWords  = 1500
+)
+
+// SetLengthThresholds sets word count thresholds for `lengthClass`
+// template function: content with at most short words is "short",
+// content with at least long words is "long".
+func (c *Collection) SetLengthThresholds(short, long int) {
+	c.shortWords = short
+	c.longWords = long
+}
+
+// SetLayoutByLength sets layouts for pages without `layout` in meta
+// depending on the number of words in their content: each layout
+// maps to the minimum number of words, and the layout with the
+// greatest threshold not exceeding it is picked. If content is
+// shorter than all thresholds, the default layout is used.
+func (c *Collection) SetLayoutByLength(layouts map[string]int) {
+	c.layoutByLength = layouts
+}
+
+// defaultLayout returns name of layout for page without `layout` in meta.
+func (c *Collection) defaultLayout(pageContext PageContext, defaultLayoutName string) string {
+	if len(c.layoutByLength) == 0 {
+		return defaultLayoutName
+	}
+	n := CountWords(pageContext.Content())
+	name, max := defaultLayoutName, -1
+	for l, min := range c.layoutByLength {
+		if n >= min && (min > max || min == max && l < name) {
+			name, max = l, min
+		}
+	}
+	return name
+}
+
+// DefaultDescriptionLen is the default maximum length of
+// generated page descriptions.
+const DefaultDescriptionLen = 160
+
+// SetAutoDescription sets whether pages without `description` in meta
+// get it generated from the first maxLen characters of their content
+// after executing it as a template. If maxLen is not positive,
+// DefaultDescriptionLen is used. Generated description is not available
+// to the page content itself, only to its layouts.
+func (c *Collection) SetAutoDescription(enabled bool, maxLen int) {
+	if maxLen <= 0 {
+		maxLen = DefaultDescriptionLen
+	}
+	c.autoDescription = enabled
+	c.autoDescriptionLen = maxLen
+}
+
+// SetIncludeFallback sets collection in which `include` template
+// function looks for includes not found in this collection.
+func (c *Collection) SetIncludeFallback(fallback *Collection) {
+	c.fallback = fallback
+}
+
+// LinkCollection makes includes of other collection available
+// under the given name to `includeFrom` template function.
+func (c *Collection) LinkCollection(name string, other *Collection) {
+	c.linked[name] = other
+}
+
+// SetPlaceholder sets include, which is returned by
+// `placeholder` template function for the given name.
+func (c *Collection) SetPlaceholder(name, includeName string) {
+	c.placeholders[name] = includeName
+}
+
+// SetDevMode sets development mode, which is used when
+// watching for changes or serving site locally.
+func (c *Collection) SetDevMode(dev bool) {
+	c.devMode = dev
+}
+
+// DefaultDraftWatermark is the default HTML added to drafts.
+const DefaultDraftWatermark = `<div class="draft-watermark" style="position:fixed;top:1em;right:1em;z-index:9999;padding:.25em .5em;background:#c00;color:#fff;font:bold 1em sans-serif;opacity:.8;pointer-events:none">DRAFT</div>`
+
+// SetDraftWatermark sets whether HTML pages with `draft: true`
+// in meta get watermark in development mode.
+func (c *Collection) SetDraftWatermark(enabled bool) {
+	if !enabled {
+		c.draftWatermark = ""
+	} else if c.draftWatermark == "" {
+		c.draftWatermark = DefaultDraftWatermark
 	}
 }
 
+// SetDraftWatermarkHTML sets HTML of draft watermark, which is inserted
+// before </body> or appended to output, and enables watermark.
+func (c *Collection) SetDraftWatermarkHTML(html string) {
+	c.draftWatermark = html
+}
+
+// SetDevMissingPartialPlaceholder sets whether `include` of a missing
+// include returns a placeholder comment instead of an error.
+// It only takes effect in development mode.
+func (c *Collection) SetDevMissingPartialPlaceholder(value bool) {
+	c.missingPartialComment = value
+}
+
+// SetRecoverFuncPanics sets whether errors of layout execution are
+// returned as *RenderError naming page and layout, and panics raised
+// outside of template function calls, for example, by site's LayoutData
+// or page's Content, are recovered and returned as such errors, so that
+// other pages can still be rendered. Panics in template functions are
+// always turned into execution errors by text/template.
+//
+// By default, execution errors are returned as is and other panics
+// are not recovered.
+func (c *Collection) SetRecoverFuncPanics(value bool) {
+	c.recoverPanics = value
+}
+
+// RenderError is an error that occurred when executing layout for page.
+type RenderError struct {
+	URL    string // page URL
+	Layout string // layout name, empty for page content
+	Err    error
+}
+
+func (e *RenderError) Error() string {
+	if e.Layout == "" {
+		return fmt.Sprintf("page %q: %s", e.URL, e.Err)
+	}
+	return fmt.Sprintf("page %q, layout %q: %s", e.URL, e.Layout, e.Err)
+}
+
+// SetNow sets the function returning current time for template functions.
+// Useful for reproducible builds. If now is nil, time.Now is used.
+func (c *Collection) SetNow(now func() time.Time) {
+	if now == nil {
+		now = time.Now
+	}
+	c.now = now
+}
+
+// funcs returns template functions provided by collection, bound to
+// the given render state, combined with functions provided by site context.
+func (c *Collection) funcs(st *renderState) template.FuncMap {
+	m := template.FuncMap(c.builtinFuncs(st))
+	for k, v := range c.context.LayoutFuncs() {
+		m[k] = v
+	}
+	return m
+}
+
+// bind returns copy of template with functions bound to render state.
+func (c *Collection) bind(t *template.Template, st *renderState) (*template.Template, error) {
+	t, err := t.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return t.Funcs(c.funcs(st)), nil
+}
+
 func (c *Collection) newLayout(name string, parentName string, content string) (l *Layout, err error) {
-	t, err := template.New(name).Funcs(template.FuncMap(c.context.LayoutFuncs())).Parse(content)
+	t, err := template.New(name).Funcs(c.funcs(nil)).Parse(content)
 	if err != nil {
 		return nil, err
 	}
@@ -62,29 +587,98 @@ func (c *Collection) newLayout(name string, parentName string, content string) (
 	}, nil
 }
 
-func layoutNameFromMeta(meta map[string]interface{}) (string, error) {
-	l, ok := meta["layout"]
+// stringFromMeta returns string value of key from meta.
+func stringFromMeta(meta map[string]interface{}, key string) (string, error) {
+	v, ok := meta[key]
 	if ok {
-		name, ok := l.(string)
+		s, ok := v.(string)
 		if !ok {
-			return "", fmt.Errorf("`layout` must be a string")
+			return "", fmt.Errorf("`%s` must be a string", key)
 		}
-		return name, nil
+		return s, nil
 	}
 	return "", nil
 }
 
+// ExtendsConflictPolicy determines which parent layout is used
+// if meta has both `layout` and `extends` keys.
+type ExtendsConflictPolicy int
+
+const (
+	ExtendsConflictError ExtendsConflictPolicy = iota // return an error
+	ExtendsWins                                       // use `extends`
+	LayoutWins                                        // use `layout`
+)
+
+// SetExtendsConflictPolicy sets policy for meta with both `layout` and
+// `extends` keys. `extends` is the same as `layout` when used alone.
+func (c *Collection) SetExtendsConflictPolicy(policy ExtendsConflictPolicy) {
+	c.extendsConflict = policy
+}
+
+// SetImplicitParent sets name of layout used as parent of layouts
+// which don't specify one. Layouts with `layout: none` have no parent.
+func (c *Collection) SetImplicitParent(name string) {
+	c.implicitParent = name
+}
+
+// parentName returns name of parent layout of l.
+func (c *Collection) parentName(l *Layout) string {
+	if l.ParentName == "" && l.Name != c.implicitParent {
+		return c.implicitParent
+	}
+	return l.ParentName
+}
+
+func (c *Collection) layoutNameFromMeta(meta map[string]interface{}) (string, error) {
+	layout, err := stringFromMeta(meta, "layout")
+	if err != nil {
+		return "", err
+	}
+	extends, err := stringFromMeta(meta, "extends")
+	if err != nil {
+		return "", err
+	}
+	if layout == "" {
+		return extends, nil
+	}
+	if extends == "" {
+		return layout, nil
+	}
+	switch c.extendsConflict {
+	case ExtendsWins:
+		return extends, nil
+	case LayoutWins:
+		return layout, nil
+	default:
+		return "", fmt.Errorf("both `layout` (%q) and `extends` (%q) are set", layout, extends)
+	}
+}
+
 func (c *Collection) newLayoutFromFile(filename string, stripExtension bool) (l *Layout, err error) {
 	f, err := metafile.Open(filename)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
+	l, err = c.newLayoutFromMetafile(filename, f, stripExtension)
+	if err != nil {
+		return nil, err
+	}
+	l.Filename = filename
+	return l, nil
+}
+
+func (c *Collection) newLayoutFromMetafile(filename string, f *metafile.File, stripExtension bool) (l *Layout, err error) {
 	name := filepath.Base(filename)
 	if stripExtension {
 		name = name[:len(name)-len(filepath.Ext(name))]
 	}
-	parentName, err := layoutNameFromMeta(f.Meta())
+	parentName, err := c.layoutNameFromMeta(f.Meta())
+	if err != nil {
+		return nil, err
+	}
+	noCache, err := noCacheFromMeta(f.Meta())
 	if err != nil {
 		return nil, err
 	}
@@ -92,7 +686,40 @@ func (c *Collection) newLayoutFromFile(filename string, stripExtension bool) (l
 	if err != nil {
 		return nil, err
 	}
-	return c.newLayout(name, parentName, string(content))
+	l, err = c.newLayout(name, parentName, string(content))
+	if err != nil {
+		return nil, err
+	}
+	l.NoCache = noCache
+	return l, nil
+}
+
+// noCacheFromMeta reports whether meta has `cache: false`.
+func noCacheFromMeta(meta map[string]interface{}) (bool, error) {
+	v, ok := meta["cache"]
+	if !ok {
+		return false, nil
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("`cache` must be a boolean")
+	}
+	return !b, nil
+}
+
+// cacheable reports whether rendered page can be cached: neither
+// the page nor any layout in its chain has `cache: false` in meta.
+func (c *Collection) cacheable(pageContext PageContext, defaultLayoutName string) (bool, error) {
+	noCache, err := noCacheFromMeta(pageContext.Meta())
+	if err != nil || noCache {
+		return false, err
+	}
+	for _, name := range c.layoutChain(pageContext, defaultLayoutName) {
+		if l := c.layouts[name]; l != nil && l.NoCache {
+			return false, nil
+		}
+	}
+	return true, nil
 }
 
 func (c *Collection) AddFile(filename string) error {
@@ -100,16 +727,27 @@ func (c *Collection) AddFile(filename string) error {
 	if err != nil {
 		return err
 	}
+	c.checkDeprecated(l.Template, filename)
 	c.layouts[l.Name] = l
+	c.resetSourceHash()
 	log.Printf("L %s", l.Name)
 	return nil
 }
 
+// AddDir adds layouts from files in directory and its subdirectories.
+// Files and directories with names starting with a dot are skipped.
 func (c *Collection) AddDir(dirname string) error {
 	return filepath.Walk(dirname, func(path string, fi os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		if path != dirname && strings.HasPrefix(fi.Name(), ".") {
+			c.warn(SkippedWarning, path, "skipped dotfile")
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
 		if fi.IsDir() {
 			return nil
 		}
@@ -117,69 +755,660 @@ func (c *Collection) AddDir(dirname string) error {
 	})
 }
 
-func (c *Collection) renderLayout(l *Layout, pageContext PageContext, content string) (out string, err error) {
-	// Execute current layout.
+// pageMeta returns page meta with added generated values.
+// Pages with source path get it as `source_path` and, if they
+// have no `id`, id made from it. Pages without `lang` get
+// the default locale.
+func (c *Collection) pageMeta(pageContext PageContext) map[string]interface{} {
+	meta := pageContext.Meta()
+	source := sourcePath(pageContext)
+	_, hasLang := meta["lang"]
+	addLang := !hasLang && c.defaultLocale != ""
+	if source == "" && !addLang {
+		return meta
+	}
+	// Copy meta to avoid modifying page.
+	m := make(map[string]interface{}, len(meta)+3)
+	for k, v := range meta {
+		m[k] = v
+	}
+	if source != "" {
+		m["source_path"] = filepath.ToSlash(source)
+		if _, ok := meta["id"]; !ok {
+			m["id"] = sourceID(source)
+		}
+	}
+	if addLang {
+		m["lang"] = c.defaultLocale
+	}
+	return m
+}
+
+// withDescription returns meta with `description` generated from
+// content if automatic descriptions are enabled and meta has none.
+func (c *Collection) withDescription(meta map[string]interface{}, content string) map[string]interface{} {
+	if _, ok := meta["description"]; ok || !c.autoDescription {
+		return meta
+	}
+	m := make(map[string]interface{}, len(meta)+1)
+	for k, v := range meta {
+		m[k] = v
+	}
+	m["description"] = describe(content, c.autoDescriptionLen)
+	return m
+}
+
+// describe returns plain text of the given HTML content
+// truncated to maxLen characters at word boundary.
+func describe(content string, maxLen int) string {
+	words := strings.Fields(utils.StripHTMLTags(content))
+	n := 0
+	for i, w := range words {
+		n += utf8.RuneCountInString(w)
+		if i > 0 {
+			n++ // space
+		}
+		if n > maxLen {
+			if i == 0 {
+				return string([]rune(w)[:maxLen]) + "..."
+			}
+			return strings.Join(words[:i], " ") + "..."
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// VCSInfo describes version control state of site sources.
+type VCSInfo struct {
+	Commit string
+	Branch string
+	Dirty  bool // uncommitted changes
+}
+
+// SetVCSInfo sets version control information available to templates
+// as .Site.vcs with commit, branch, and dirty keys if site data is
+// a map with string keys, and from `vcs` template function.
+func (c *Collection) SetVCSInfo(info VCSInfo) {
+	c.vcsInfo = &info
+}
+
+// VCS returns version control information set with SetVCSInfo
+// as a map with commit, branch, and dirty keys, or nil.
+func (c *Collection) VCS() map[string]interface{} {
+	if c.vcsInfo == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"commit": c.vcsInfo.Commit,
+		"branch": c.vcsInfo.Branch,
+		"dirty":  c.vcsInfo.Dirty,
+	}
+}
+
+// SetSiteStats sets aggregate site statistics, such as pageCount,
+// totalWords, and lastBuild, available to templates as .Site.stats
+// if site data is a map with string keys.
+func (c *Collection) SetSiteStats(stats map[string]interface{}) {
+	c.siteStats = stats
+}
+
+// SiteStats returns site statistics set with SetSiteStats.
+func (c *Collection) SiteStats() map[string]interface{} {
+	return c.siteStats
+}
+
+// siteData returns site data for templates.
+// If site data is a map with string keys, its copy
+// gets buildID, vcs, stats, and debug keys when they are set.
+func (c *Collection) siteData() interface{} {
+	data := c.context.LayoutData()
+	keys := make(map[string]interface{})
+	if c.exposeBuildID {
+		keys["buildID"] = c.BuildID()
+	}
+	if c.vcsInfo != nil {
+		keys["vcs"] = c.VCS()
+	}
+	if c.siteStats != nil {
+		keys["stats"] = c.siteStats
+	}
+	if c.debugConfig {
+		keys["debug"] = c.DebugInfo()
+	}
+	if len(keys) == 0 {
+		return data
+	}
+	return withKeys(data, keys)
+}
+
+// withKeys returns copy of map m of any type with string keys,
+// such as map[string]interface{}, with keys added to it. Methods
+// of named map types are thus kept. Other values are returned as is.
+func withKeys(m interface{}, keys map[string]interface{}) interface{} {
+	v := reflect.ValueOf(m)
+	if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+		return m
+	}
+	out := reflect.MakeMap(v.Type())
+	for _, k := range v.MapKeys() {
+		out.SetMapIndex(k, v.MapIndex(k))
+	}
+	for k, x := range keys {
+		xv := reflect.ValueOf(x)
+		if !xv.Type().AssignableTo(v.Type().Elem()) {
+			continue
+		}
+		out.SetMapIndex(reflect.ValueOf(k).Convert(v.Type().Key()), xv)
+	}
+	return out.Interface()
+}
+
+// SetBuildID sets build identifier and makes it available as
+// .Site.buildID if site data is a map. If id is empty, build
+// identifier is derived from layouts and includes.
+func (c *Collection) SetBuildID(id string) {
+	c.buildID = id
+	c.exposeBuildID = true
+}
+
+// BuildID returns build identifier set with SetBuildID or, if it's not
+// set, made from hash of layouts and includes, which is the same
+// for identical sources. It's available to templates as `buildID`.
+func (c *Collection) BuildID() string {
+	if c.buildID != "" {
+		return c.buildID
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sourceHash == "" {
+		c.sourceHash = c.hashSources()
+	}
+	return c.sourceHash
+}
+
+// resetSourceHash resets cached hash of layouts and includes
+// after they change, so that BuildID computes it again.
+func (c *Collection) resetSourceHash() {
+	c.mu.Lock()
+	c.sourceHash = ""
+	c.mu.Unlock()
+}
+
+// hashSources returns hash of layouts and includes.
+func (c *Collection) hashSources() string {
+	h := sha256.New()
+	names := make([]string, 0, len(c.layouts))
+	for name := range c.layouts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		l := c.layouts[name]
+		fmt.Fprintf(h, "layout %q %q\n", name, l.ParentName)
+		for _, t := range l.Template.Templates() {
+			if t.Tree != nil && t.Tree.Root != nil {
+				fmt.Fprintf(h, "%q %q\n", t.Name(), t.Tree.Root.String())
+			}
+		}
+	}
+	names = names[:0]
+	for name := range c.includes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(h, "include %q %q\n", name, c.includes[name])
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// SetExposeDebugConfig sets whether effective options of collection are
+// available to templates as .Site.debug.config if site data is a map.
+// Use it only for debugging, since it reveals internal details.
+func (c *Collection) SetExposeDebugConfig(value bool) {
+	c.debugConfig = value
+}
+
+// DebugInfo returns map with effective options of collection
+// under config key if enabled with SetExposeDebugConfig, or nil.
+func (c *Collection) DebugInfo() map[string]interface{} {
+	if !c.debugConfig {
+		return nil
+	}
+	return map[string]interface{}{"config": c.effectiveConfig()}
+}
+
+// effectiveConfig returns map describing options of collection.
+func (c *Collection) effectiveConfig() map[string]interface{} {
+	open, close := metafile.Delimiter()
+	pipeline := make([]string, len(c.pipeline))
+	for i, s := range c.pipeline {
+		pipeline[i] = string(s)
+	}
+	return map[string]interface{}{
+		"engine":             "text/template",
+		"pipeline":           pipeline,
+		"delimiters":         []string{open, close},
+		"strictTranslations": c.strictTranslations,
+		"strictLinks":        c.strictLinks,
+		"renderCache":        renderedCache != nil,
+		"devMode":            c.devMode,
+		"defaultLocale":      c.defaultLocale,
+		"baseURL":            c.baseURL,
+		"maxLayoutDepth":     c.maxLayoutDepth,
+		"implicitParent":     c.implicitParent,
+		"headingAnchors":     c.headingAnchors,
+		"recoverFuncPanics":  c.recoverPanics,
+		"autoDescription":    c.autoDescription,
+		"prettyURLs":         !c.uglyURLs,
+		"finalNewline":       int(c.finalNewline),
+		"includes":           len(c.includes),
+		"layouts":            len(c.layouts),
+	}
+}
+
+// execute executes layout template for page with the given content.
+func (c *Collection) execute(st *renderState, l *Layout, pageContext PageContext, content string) (out string, err error) {
+	if c.recoverPanics {
+		defer func() {
+			// Panics in template functions are recovered by
+			// text/template; this catches the rest.
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+			}
+			if err != nil {
+				err = &RenderError{URL: pageContext.URL(), Layout: l.Name, Err: err}
+			}
+		}()
+	}
+	t, err := c.bind(l.Template, st)
+	if err != nil {
+		return "", err
+	}
 	var buf bytes.Buffer
-	err = l.Template.Execute(&buf, struct {
+	err = t.Execute(&buf, struct {
 		Site    interface{}
 		Page    interface{}
 		Content string
 	}{
-		c.context.LayoutData(),
-		pageContext.Meta(),
+		c.siteData(),
+		st.meta,
 		content,
 	})
 	if err != nil {
-		return
+		return "", err
 	}
+	return buf.String(), nil
+}
+
+func (c *Collection) renderLayout(st *renderState, l *Layout, pageContext PageContext, content string) (out string, err error) {
+	return c.renderLayoutDepth(st, l, pageContext, content, 0)
+}
 
-	out = buf.String()
+// renderLayoutDepth renders layout, which is the depth-th
+// parent of page, and its parents.
+func (c *Collection) renderLayoutDepth(st *renderState, l *Layout, pageContext PageContext, content string, depth int) (out string, err error) {
+	if depth > c.maxLayoutDepth {
+		return "", fmt.Errorf("layout %q exceeds maximum layout depth %d", l.Name, c.maxLayoutDepth)
+	}
+	// Execute current layout.
+	out, err = c.execute(st, l, pageContext, content)
+	if err != nil {
+		return
+	}
 
-	if l.ParentName != "" && l.ParentName != "none" {
+	if parentName := c.parentName(l); parentName != "" && parentName != "none" {
 		// Execute parent layout on output.
-		parentLayout, ok := c.layouts[l.ParentName]
+		parentLayout, ok := c.layouts[parentName]
 		if !ok {
-			return "", fmt.Errorf("layout %q not found", l.ParentName)
+			return "", fmt.Errorf("layout %q not found", parentName)
 		}
-		return c.renderLayout(parentLayout, pageContext, out)
+		return c.renderLayoutDepth(st, parentLayout, pageContext, out, depth+1)
 	}
 	return out, nil
 }
 
+// RenderPage renders page with its layouts. Pages can be rendered
+// concurrently, but collection must not be changed meanwhile.
 func (c *Collection) RenderPage(pageContext PageContext, defaultLayoutName string) (out string, err error) {
-	if renderedCache != nil {
+	useCache := renderedCache != nil
+	if useCache {
+		if useCache, err = c.cacheable(pageContext, defaultLayoutName); err != nil {
+			return "", err
+		}
+	}
+	if useCache {
 		// Check cache
 		if rendered, ok := renderedCache.Get(pageContext.URL(), pageContext.FileInfo()); ok {
 			return rendered, nil
 		}
 	}
-	layoutName, err := layoutNameFromMeta(pageContext.Meta())
+	out, includes, err := c.render(pageContext, defaultLayoutName)
+	if err == nil {
+		c.record(pageContext, defaultLayoutName, includes)
+	}
+	if err == nil && useCache {
+		// Add to cache
+		tags, err := cacheTags(pageContext.Meta())
+		if err != nil {
+			return "", err
+		}
+		renderedCache.Put(pageContext.URL(), pageContext.FileInfo(), out, tags)
+	}
+	return out, err
+}
+
+// RenderResult is the result of rendering a page.
+type RenderResult struct {
+	Output      string
+	ContentType string
+	Lines       int      // number of lines in output
+	Partials    []string // names of used includes
+	Layout      string   // name of page layout, or "none"
+	Duration    time.Duration
+}
+
+// LayoutMetric describes pages rendered with a layout.
+type LayoutMetric struct {
+	Count    int           // number of rendered pages
+	Duration time.Duration // total time spent rendering
+	Bytes    int64         // total size of output
+}
+
+// LayoutMetrics returns metrics of pages rendered with
+// RenderPageResult aggregated by name of page layout.
+func (c *Collection) LayoutMetrics() map[string]LayoutMetric {
+	c.metricsMu.Lock()
+	defer c.metricsMu.Unlock()
+	m := make(map[string]LayoutMetric, len(c.metrics))
+	for k, v := range c.metrics {
+		m[k] = v
+	}
+	return m
+}
+
+// addMetric adds rendering result to layout metrics.
+func (c *Collection) addMetric(r *RenderResult) {
+	c.metricsMu.Lock()
+	defer c.metricsMu.Unlock()
+	m := c.metrics[r.Layout]
+	m.Count++
+	m.Duration += r.Duration
+	m.Bytes += int64(len(r.Output))
+	c.metrics[r.Layout] = m
+}
+
+// RenderPageResult renders page like RenderPage and returns the result
+// along with its content type, which is taken from page's `content_type`
+// meta or determined from extension of the outermost layout or page URL.
+func (c *Collection) RenderPageResult(pageContext PageContext, defaultLayoutName string) (*RenderResult, error) {
+	start := time.Now()
+	out, err := c.RenderPage(pageContext, defaultLayoutName)
+	duration := time.Since(start)
+	if err != nil {
+		return nil, err
+	}
+	contentType, err := c.contentType(pageContext, defaultLayoutName)
+	if err != nil {
+		return nil, err
+	}
+	r := &RenderResult{
+		Output:      out,
+		ContentType: contentType,
+		Lines:       countLines(out),
+		Layout:      "none",
+		Duration:    duration,
+	}
+	if chain := c.layoutChain(pageContext, defaultLayoutName); len(chain) > 0 {
+		r.Layout = chain[0]
+	}
+	c.mu.Lock()
+	if rec := c.records[pageContext.URL()]; rec != nil {
+		r.Partials = rec.includes
+	}
+	c.mu.Unlock()
+	c.addMetric(r)
+	if c.renderObserver != nil {
+		c.renderObserver(pageContext, r)
+	}
+	return r, nil
+}
+
+// countLines returns the number of lines in s.
+func countLines(s string) int {
+	n := strings.Count(s, "\n")
+	if len(s) > 0 && s[len(s)-1] != '\n' {
+		n++ // last line without newline
+	}
+	return n
+}
+
+// isHTML reports whether page is rendered into HTML.
+func (c *Collection) isHTML(pageContext PageContext, defaultLayoutName string) bool {
+	ct, err := c.contentType(pageContext, defaultLayoutName)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(ct, "text/html") || strings.HasPrefix(ct, "application/xhtml+xml")
+}
+
+func (c *Collection) contentType(pageContext PageContext, defaultLayoutName string) (string, error) {
+	if ct, ok := pageContext.Meta()["content_type"]; ok {
+		s, ok := ct.(string)
+		if !ok {
+			return "", fmt.Errorf("`content_type` must be a string")
+		}
+		return s, nil
+	}
+	if ct := mime.TypeByExtension(c.outputExt(pageContext, defaultLayoutName)); ct != "" {
+		return ct, nil
+	}
+	return "application/octet-stream", nil
+}
+
+// outputExt returns extension of the outermost layout
+// of page or of page URL, defaulting to ".html".
+func (c *Collection) outputExt(pageContext PageContext, defaultLayoutName string) string {
+	ext := ""
+	if chain := c.layoutChain(pageContext, defaultLayoutName); len(chain) > 0 {
+		if l := c.layouts[chain[len(chain)-1]]; l != nil {
+			ext = filepath.Ext(l.Filename)
+		}
+	}
+	if ext == "" {
+		ext = path.Ext(pageContext.URL())
+	}
+	if ext == "" {
+		ext = ".html"
+	}
+	return ext
+}
+
+// renderState is the state of rendering a page, which is passed down
+// to template functions instead of being kept in collection, so that
+// pages can be rendered concurrently.
+type renderState struct {
+	parent    *renderState // state of page rendering this page, if any
+	page      PageContext
+	meta      map[string]interface{} // page meta with generated values
+	locale    string                 // page locale, if any
+	includes  map[string]bool        // names of used includes
+	active    map[activeInclude]bool // includes executed by `includeFrom`
+	tmplDepth int                    // nesting of `tmpl` calls
+}
+
+// activeInclude identifies include executed by `includeFrom`.
+type activeInclude struct {
+	c    *Collection
+	name string
+}
+
+// rendering reports whether page with url is being rendered
+// in this state or any of its parents.
+func (st *renderState) rendering(url string) bool {
+	for ; st != nil; st = st.parent {
+		if st.page != nil && st.page.URL() == url {
+			return true
+		}
+	}
+	return false
+}
+
+// render renders page with its layouts without using cache.
+// It returns sorted names of includes used by page.
+func (c *Collection) render(pageContext PageContext, defaultLayoutName string) (out string, includes []string, err error) {
+	return c.renderStages(nil, pageContext, defaultLayoutName, c.pipeline)
+}
+
+// renderStages renders page by running the given stages of pipeline.
+// If page is rendered by another page, parent is its render state.
+func (c *Collection) renderStages(parent *renderState, pageContext PageContext, defaultLayoutName string, stages []Stage) (out string, includes []string, err error) {
+	layoutName, err := c.layoutNameFromMeta(pageContext.Meta())
 	if err != nil {
 		return
 	}
 	if layoutName == "" {
-		layoutName = defaultLayoutName
+		layoutName = c.defaultLayout(pageContext, defaultLayoutName)
 	}
-	p, err := c.newLayout("", layoutName, pageContext.Content())
+	// Set page locale, if any, for translations.
+	lang, err := stringFromMeta(pageContext.Meta(), "lang")
 	if err != nil {
 		return
 	}
-	out, err = c.renderLayout(p, pageContext, pageContext.Content())
-	if err == nil && renderedCache != nil {
-		// Add to cache
-		renderedCache.Put(pageContext.URL(), pageContext.FileInfo(), out)
+	st := &renderState{
+		parent:   parent,
+		page:     pageContext,
+		meta:     c.pageMeta(pageContext),
+		locale:   lang,
+		includes: make(map[string]bool),
+	}
+	out = pageContext.Content()
+	if strings.TrimSpace(out) == "" && c.emptyBody != "" {
+		out = c.emptyBody
+	}
+	// Description is generated from the output of template
+	// stage, or from content if there's no such stage.
+	hasTemplateStage := false
+	for _, stage := range stages {
+		if stage == TemplateStage {
+			hasTemplateStage = true
+		}
+	}
+	if !hasTemplateStage {
+		st.meta = c.withDescription(st.meta, out)
+	}
+	for _, stage := range stages {
+		out, err = c.runStage(st, stage, pageContext, layoutName, defaultLayoutName, out)
+		if err != nil {
+			return "", nil, err
+		}
+		if stage == TemplateStage {
+			st.meta = c.withDescription(st.meta, out)
+		}
+	}
+	includes = make([]string, 0, len(st.includes))
+	for name := range st.includes {
+		includes = append(includes, name)
+	}
+	sort.Strings(includes)
+	return out, includes, nil
+}
+
+// localizedPage is a page with meta overridden for some locale.
+type localizedPage struct {
+	PageContext
+	meta map[string]interface{}
+}
+
+func (p *localizedPage) Meta() map[string]interface{} { return p.meta }
+func (p *localizedPage) SourcePath() string           { return sourcePath(p.PageContext) }
+
+// RenderLocalized renders page in the given locale. Values from page's
+// `translations` meta for this locale override the original meta values,
+// and `lang` is set to locale. Rendered localized pages are not cached.
+func (c *Collection) RenderLocalized(pageContext PageContext, defaultLayoutName string, locale string) (out string, err error) {
+	meta := pageContext.Meta()
+	m := make(map[string]interface{}, len(meta)+1)
+	for k, v := range meta {
+		m[k] = v
+	}
+	m["lang"] = locale
+	var overrides map[interface{}]interface{}
+	switch t := meta["translations"].(type) {
+	case nil:
+		// no translations
+	case map[interface{}]interface{}:
+		overrides, _ = t[locale].(map[interface{}]interface{})
+	case map[string]interface{}:
+		overrides, _ = t[locale].(map[interface{}]interface{})
+		if o, ok := t[locale].(map[string]interface{}); ok {
+			overrides = make(map[interface{}]interface{}, len(o))
+			for k, v := range o {
+				overrides[k] = v
+			}
+		}
+	default:
+		return "", fmt.Errorf("`translations` must be a map")
+	}
+	for k, v := range overrides {
+		m[fmt.Sprint(k)] = v
+	}
+	out, _, err = c.render(&localizedPage{pageContext, m}, defaultLayoutName)
+	return out, err
+}
+
+// RenderContent renders page content by running template, markdown,
+// and sanitize stages of the pipeline, but doesn't apply any layouts
+// regardless of page meta. Rendered content is not cached.
+func (c *Collection) RenderContent(pageContext PageContext) (out string, err error) {
+	return c.renderContent(nil, pageContext)
+}
+
+// renderContent renders page content like RenderContent.
+// If page is rendered by another page, parent is its render state.
+func (c *Collection) renderContent(parent *renderState, pageContext PageContext) (out string, err error) {
+	var stages []Stage
+	for _, s := range c.pipeline {
+		switch s {
+		case TemplateStage, MarkdownStage, SanitizeStage:
+			stages = append(stages, s)
+		}
 	}
+	out, _, err = c.renderStages(parent, pageContext, "none", stages)
 	return out, err
 }
 
+// RenderPageGzip renders page like RenderPage and returns
+// its output compressed with gzip at the given level.
+func (c *Collection) RenderPageGzip(pageContext PageContext, defaultLayoutName string, level int) ([]byte, error) {
+	out, err := c.RenderPage(pageContext, defaultLayoutName)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write([]byte(out)); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 type cache struct {
-	mu sync.Mutex
-	m  map[string]cacheEntry
+	mu   sync.Mutex
+	m    map[string]cacheEntry
+	tags map[string]map[string]bool // tag -> names of entries
 }
 
 type cacheEntry struct {
 	fi       os.FileInfo
 	rendered string
+	tags     []string
 }
 
 func (c *cache) Get(name string, fi os.FileInfo) (string, bool) {
@@ -191,19 +1420,86 @@ func (c *cache) Get(name string, fi os.FileInfo) (string, bool) {
 	}
 	if e.fi.ModTime() != fi.ModTime() || e.fi.Size() != fi.Size() || e.fi.Mode() != fi.Mode() {
 		// This entry changed, delete it from cache.
-		delete(c.m, name)
+		c.delete(name)
 		return "", false
 	}
 	return e.rendered, true
 }
 
-func (c *cache) Put(name string, fi os.FileInfo, rendered string) {
+func (c *cache) Put(name string, fi os.FileInfo, rendered string, tags []string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.delete(name)
 	c.m[name] = cacheEntry{
 		fi:       fi,
 		rendered: rendered,
+		tags:     tags,
+	}
+	for _, tag := range tags {
+		if c.tags[tag] == nil {
+			c.tags[tag] = make(map[string]bool)
+		}
+		c.tags[tag][name] = true
+	}
+}
+
+// delete deletes entry from cache and tag index.
+// It must be called with mutex held.
+func (c *cache) delete(name string) {
+	e, ok := c.m[name]
+	if !ok {
+		return
+	}
+	for _, tag := range e.tags {
+		delete(c.tags[tag], name)
+		if len(c.tags[tag]) == 0 {
+			delete(c.tags, tag)
+		}
+	}
+	delete(c.m, name)
+}
+
+func (c *cache) InvalidateTag(tag string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	names := make([]string, 0, len(c.tags[tag]))
+	for name := range c.tags[tag] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c.delete(name)
+	}
+	return names
+}
+
+// cacheTags returns tags from page's `cache_tags` meta.
+func cacheTags(meta map[string]interface{}) ([]string, error) {
+	switch v := meta["cache_tags"].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []string:
+		return v, nil
+	case []interface{}:
+		tags := make([]string, len(v))
+		for i, x := range v {
+			tags[i] = fmt.Sprint(x)
+		}
+		return tags, nil
+	default:
+		return nil, fmt.Errorf("`cache_tags` must be a list")
+	}
+}
+
+// InvalidateTag removes rendered pages with the given tag in their
+// `cache_tags` meta from cache. It returns URLs of removed pages.
+func InvalidateTag(tag string) []string {
+	if renderedCache == nil {
+		return nil
 	}
+	return renderedCache.InvalidateTag(tag)
 }
 
 var renderedCache *cache
@@ -211,7 +1507,8 @@ var renderedCache *cache
 func EnableCache(value bool) {
 	if value {
 		renderedCache = &cache{
-			m: make(map[string]cacheEntry),
+			m:    make(map[string]cacheEntry),
+			tags: make(map[string]map[string]bool),
 		}
 	} else {
 		renderedCache = nil
@@ -0,0 +1,1389 @@
+// Copyright 2013 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package layouts
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testSite struct {
+	data  interface{}
+	funcs FuncMap
+}
+
+func (s *testSite) LayoutData() interface{} { return s.data }
+func (s *testSite) LayoutFuncs() FuncMap    { return s.funcs }
+
+type testPage struct {
+	meta    map[string]interface{}
+	content string
+	url     string
+	source  string
+	fi      os.FileInfo
+}
+
+func (p *testPage) Meta() map[string]interface{} { return p.meta }
+func (p *testPage) Content() string              { return p.content }
+func (p *testPage) URL() string                  { return p.url }
+func (p *testPage) FileInfo() os.FileInfo        { return p.fi }
+func (p *testPage) SourcePath() string           { return p.source }
+
+func newTestCollection() *Collection {
+	return NewCollection(&testSite{funcs: FuncMap{}})
+}
+
+// addLayout adds a layout with the given parent and content to collection.
+func addLayout(t *testing.T, c *Collection, name, parentName, content string) {
+	l, err := c.newLayout(name, parentName, content)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	c.layouts[name] = l
+}
+
+func renderString(t *testing.T, c *Collection, content string) string {
+	out, err := c.RenderPage(&testPage{content: content, url: "/test/"}, "none")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	return out
+}
+
+func TestNow(t *testing.T) {
+	c := newTestCollection()
+	c.SetNow(func() time.Time {
+		return time.Date(2012, 3, 4, 5, 6, 7, 0, time.UTC)
+	})
+	out := renderString(t, c, `&copy; {{year}} {{month}}/{{day}} {{now.Year}}`)
+	if exp := "&copy; 2012 3/4 2012"; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+}
+
+func TestMissingPartialPlaceholder(t *testing.T) {
+	c := newTestCollection()
+	c.AddInclude("foo", "FOO")
+	c.SetDevMissingPartialPlaceholder(true)
+
+	// Production.
+	_, err := c.RenderPage(&testPage{content: `{{include "bar"}}`}, "none")
+	if err == nil {
+		t.Errorf("expected error for missing include in production")
+	}
+
+	// Development.
+	c.SetDevMode(true)
+	out := renderString(t, c, `{{include "foo"}} {{include "bar"}}`)
+	if exp := "FOO <!-- missing partial: bar -->"; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	c := newTestCollection()
+	d := time.Date(2013, 3, 4, 0, 0, 0, 0, time.UTC)
+	var tests = []struct{ locale, out string }{
+		{"en", "Monday, 4 March 2013"},
+		{"de-DE", "Montag, 4 März 2013"},
+		{"xx", "Monday, 4 March 2013"},
+	}
+	for i, v := range tests {
+		out := c.localizeDate(d, v.locale, "Monday, 2 January 2006")
+		if out != v.out {
+			t.Errorf("%d: expected %q, got %q", i, v.out, out)
+		}
+	}
+	c.SetDefaultLocale("de")
+	if out, _ := c.localizeNumber(-1234567.5, "xx"); out != "-1.234.567,5" {
+		t.Errorf("expected %q, got %q", "-1.234.567,5", out)
+	}
+	if out, _ := c.localizeNumber(1234, "en"); out != "1,234" {
+		t.Errorf("expected %q, got %q", "1,234", out)
+	}
+}
+
+func TestRenderPageGzip(t *testing.T) {
+	c := newTestCollection()
+	p := &testPage{content: `Hello {{"world"}}`}
+	b, err := c.RenderPageGzip(p, "none", gzip.BestCompression)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if exp := "Hello world"; string(out) != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+	if _, err := c.RenderPageGzip(p, "none", 42); err == nil {
+		t.Errorf("expected error for invalid compression level")
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	c := newTestCollection()
+	c.SetTranslations("en", map[string]string{
+		"welcome": "Welcome!",
+		"posts":   "%d posts by %s",
+	})
+	out := renderString(t, c, `{{T "welcome"}} {{T "missing"}} {{T "posts" 3 "Bob"}}`)
+	if exp := "Welcome! missing 3 posts by Bob"; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+	c.SetStrictTranslations(true)
+	if _, err := c.translate(nil, "missing"); err == nil {
+		t.Errorf("expected error for missing translation in strict mode")
+	}
+}
+
+func TestPageLang(t *testing.T) {
+	c := newTestCollection()
+	c.SetDefaultLocale("en")
+	c.SetTranslations("en", map[string]string{"hello": "Hello"})
+	c.SetTranslations("fr", map[string]string{"hello": "Bonjour"})
+	var tests = []struct {
+		meta map[string]interface{}
+		out  string
+	}{
+		{map[string]interface{}{"lang": "fr"}, "Bonjour fr"},
+		{map[string]interface{}{"lang": "en"}, "Hello en"},
+		{map[string]interface{}{}, "Hello en"},
+	}
+	for i, v := range tests {
+		out, err := c.RenderPage(&testPage{meta: v.meta, content: `{{T "hello"}} {{with .Page.lang}}{{.}}{{end}}`}, "none")
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		if out != v.out {
+			t.Errorf("%d: expected %q, got %q", i, v.out, out)
+		}
+	}
+	c.SetDefaultLocale("fr")
+	if out := renderString(t, c, `{{T "hello"}} {{.Page.lang}}`); out != "Bonjour fr" {
+		t.Errorf("expected %q, got %q", "Bonjour fr", out)
+	}
+}
+
+func TestHreflangs(t *testing.T) {
+	c := newTestCollection()
+	c.SetBaseURL("http://example.com/")
+	c.SetTranslationsMap(func(url string) map[string]string {
+		if url != "/about/" {
+			return nil
+		}
+		return map[string]string{
+			"fr": "/fr/about/",
+			"de": "http://example.de/about/",
+		}
+	})
+	out, err := c.RenderPage(&testPage{
+		meta:    map[string]interface{}{"url": "/about/"},
+		content: `{{hreflangs .Page}}`,
+	}, "none")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	exp := `<link rel="alternate" hreflang="de" href="http://example.de/about/">` + "\n" +
+		`<link rel="alternate" hreflang="fr" href="http://example.com/fr/about/">`
+	if out != exp {
+		t.Errorf("expected\n%s\ngot\n%s", exp, out)
+	}
+}
+
+func TestRenderPageByURL(t *testing.T) {
+	c := newTestCollection()
+	pages := map[string]*testPage{
+		"/":        {url: "/", content: `Latest: {{renderPageByURL "/post/"}}`},
+		"/post/":   {url: "/post/", content: `{{"Post"}} content`},
+		"/self/":   {url: "/self/", content: `{{renderPageByURL "/self/"}}`},
+		"/loop/a/": {url: "/loop/a/", content: `{{renderPageByURL "/loop/b/"}}`},
+		"/loop/b/": {url: "/loop/b/", content: `{{renderPageByURL "/loop/a/"}}`},
+	}
+	c.SetPageResolver(func(url string) (PageContext, error) {
+		p, ok := pages[url]
+		if !ok {
+			return nil, fmt.Errorf("page %q not found", url)
+		}
+		return p, nil
+	})
+	out, err := c.RenderPage(pages["/"], "none")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if exp := "Latest: Post content"; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+	if _, err := c.RenderPage(pages["/self/"], "none"); err == nil {
+		t.Errorf("expected error for self-reference")
+	}
+	if _, err := c.RenderPage(pages["/loop/a/"], "none"); err == nil {
+		t.Errorf("expected error for recursive reference")
+	}
+}
+
+func TestAutoDescription(t *testing.T) {
+	c := newTestCollection()
+	c.SetAutoDescription(true, 20)
+	addLayout(t, c, "default", "none", `<meta content="{{.Page.description}}">{{.Content}}`)
+	var tests = []struct {
+		meta    map[string]interface{}
+		content string
+		desc    string
+	}{
+		{map[string]interface{}{}, "<p>First paragraph</p>\n<p>Second</p>", "First paragraph..."},
+		{map[string]interface{}{"description": "Given"}, "<p>First paragraph</p>", "Given"},
+		{map[string]interface{}{"title": "world"}, "<p>Hi {{.Page.title}}</p>", "Hi world"},
+	}
+	for i, v := range tests {
+		p := &testPage{meta: v.meta, content: v.content}
+		out, err := c.RenderPage(p, "default")
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		if exp := `<meta content="` + v.desc + `">`; !strings.HasPrefix(out, exp) {
+			t.Errorf("%d: expected prefix %q, got %q", i, exp, out)
+		}
+	}
+	// Default length.
+	c.SetAutoDescription(true, 0)
+	out, err := c.RenderPage(&testPage{content: "<p>Hello world</p>"}, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := `<meta content="Hello world"><p>Hello world</p>`; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+}
+
+func TestRenderLocalized(t *testing.T) {
+	c := newTestCollection()
+	c.SetTranslations("fr", map[string]string{"by": "par"})
+	p := &testPage{
+		meta: map[string]interface{}{
+			"title":  "Hello",
+			"author": "Bob",
+			"translations": map[interface{}]interface{}{
+				"fr": map[interface{}]interface{}{"title": "Bonjour"},
+			},
+		},
+		content: `{{.Page.title}} {{T "by"}} {{.Page.author}}`,
+	}
+	var tests = []struct{ locale, out string }{
+		{"fr", "Bonjour par Bob"},
+		{"de", "Hello by Bob"},
+	}
+	for i, v := range tests {
+		out, err := c.RenderLocalized(p, "none", v.locale)
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		if out != v.out {
+			t.Errorf("%d: expected %q, got %q", i, v.out, out)
+		}
+	}
+}
+
+func TestRebuild(t *testing.T) {
+	dir, err := ioutil.TempDir("", "layouts-test-")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+	writeFile := func(name, content string) string {
+		filename := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatalf("%s", err)
+		}
+		return filename
+	}
+	base := writeFile("base.html", "[{{.Content}}]")
+	writeFile("post.html", "---\nlayout: base\n---\n<{{.Content}}>")
+
+	c := newTestCollection()
+	if err := c.AddDir(dir); err != nil {
+		t.Fatalf("%s", err)
+	}
+	one := &testPage{url: "/one/", content: "one", source: "/src/one.html"}
+	two := &testPage{url: "/two/", content: "two", source: "/src/two.html"}
+	for _, p := range []*testPage{one, two} {
+		if _, err := c.RenderPage(p, "post"); err != nil {
+			t.Fatalf("%s", err)
+		}
+	}
+
+	// Change shared layout.
+	writeFile("base.html", "({{.Content}})")
+	urls, err := c.Rebuild([]string{base})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(urls) != 2 || urls[0] != "/one/" || urls[1] != "/two/" {
+		t.Errorf("expected both pages rerendered, got %q", urls)
+	}
+	out, err := c.RenderPage(one, "post")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if exp := "(<one>)"; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+
+	// Change one page.
+	urls, err = c.Rebuild([]string{"/src/two.html"})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(urls) != 1 || urls[0] != "/two/" {
+		t.Errorf("expected only /two/ rerendered, got %q", urls)
+	}
+}
+
+func TestFinalNewline(t *testing.T) {
+	var tests = []struct {
+		policy FinalNewlinePolicy
+		outs   [3]string
+	}{
+		{PreserveFinalNewline, [3]string{"a", "a\n", "a\n\n\n"}},
+		{AddFinalNewline, [3]string{"a\n", "a\n", "a\n"}},
+		{StripFinalNewline, [3]string{"a", "a", "a"}},
+	}
+	for i, v := range tests {
+		c := newTestCollection()
+		c.SetFinalNewline(v.policy)
+		for j, in := range []string{"a", "a\n", "a\n\n\n"} {
+			if out := renderString(t, c, in); out != v.outs[j] {
+				t.Errorf("%d/%d: expected %q, got %q", i, j, v.outs[j], out)
+			}
+		}
+	}
+}
+
+func TestRenderPageResultContentType(t *testing.T) {
+	c := newTestCollection()
+	addLayout(t, c, "default", "none", "<html>{{.Content}}</html>")
+	c.layouts["default"].Filename = "layouts/default.html"
+	var tests = []struct {
+		page *testPage
+		ct   string
+	}{
+		{&testPage{url: "/about/", meta: map[string]interface{}{}}, "text/html; charset=utf-8"},
+		{&testPage{url: "/feed.xml", meta: map[string]interface{}{"layout": "none"}}, mime.TypeByExtension(".xml")},
+		{&testPage{url: "/feed/", meta: map[string]interface{}{"content_type": "application/atom+xml"}}, "application/atom+xml"},
+	}
+	for i, v := range tests {
+		r, err := c.RenderPageResult(v.page, "default")
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		if r.ContentType != v.ct {
+			t.Errorf("%d: expected %q, got %q", i, v.ct, r.ContentType)
+		}
+	}
+}
+
+func TestLayoutMetrics(t *testing.T) {
+	c := newTestCollection()
+	addLayout(t, c, "default", "none", "<html>{{.Content}}</html>")
+	addLayout(t, c, "post", "default", "<article>{{.Content}}</article>")
+	pages := []*testPage{
+		{url: "/a/", content: "a", meta: map[string]interface{}{"layout": "post"}},
+		{url: "/b/", content: "b", meta: map[string]interface{}{"layout": "post"}},
+		{url: "/c/", content: "c", meta: map[string]interface{}{}},
+		{url: "/d.txt", content: "d", meta: map[string]interface{}{"layout": "none"}},
+	}
+	var total int64
+	for i, p := range pages {
+		r, err := c.RenderPageResult(p, "default")
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		total += int64(len(r.Output))
+	}
+	m := c.LayoutMetrics()
+	var tests = []struct {
+		layout string
+		count  int
+	}{
+		{"post", 2},
+		{"default", 1},
+		{"none", 1},
+	}
+	var bytes int64
+	for _, v := range tests {
+		if m[v.layout].Count != v.count {
+			t.Errorf("%s: expected count %d, got %d", v.layout, v.count, m[v.layout].Count)
+		}
+		bytes += m[v.layout].Bytes
+	}
+	if len(m) != len(tests) {
+		t.Errorf("expected %d layouts, got %d", len(tests), len(m))
+	}
+	if bytes != total {
+		t.Errorf("expected %d bytes, got %d", total, bytes)
+	}
+	if exp := int64(len("<html><article>a</article></html>")); m["post"].Bytes != 2*exp {
+		t.Errorf("post: expected %d bytes, got %d", 2*exp, m["post"].Bytes)
+	}
+}
+
+// TestRenderPageConcurrent checks that pages can be rendered in
+// parallel. Run it with -race to detect data races.
+func TestRenderPageConcurrent(t *testing.T) {
+	web := newTestCollection()
+	web.AddInclude("footer", `<footer>{{T "hello"}}</footer>`)
+	c := newTestCollection()
+	c.LinkCollection("web", web)
+	c.SetTranslations("en", map[string]string{"hello": "Hello"})
+	c.SetTranslations("fr", map[string]string{"hello": "Bonjour"})
+	web.SetTranslations("en", map[string]string{"hello": "Hello"})
+	web.SetTranslations("fr", map[string]string{"hello": "Bonjour"})
+	c.SetKnownURLs([]string{"/"}, false)
+	c.SetPageResolver(func(url string) (PageContext, error) {
+		return &testPage{url: url, content: `{{T "hello"}}`, meta: map[string]interface{}{"lang": "fr"}}, nil
+	})
+	c.AddInclude("header", "<header>{{.}}</header>")
+	addLayout(t, c, "default", "none", `<html>{{tmpl (include "header") .Page.title}}{{.Content}}{{includeFrom "web" "footer"}}</html>`)
+	const n = 50
+	results := make([]string, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			lang := "en"
+			if i%2 == 1 {
+				lang = "fr"
+			}
+			p := &testPage{
+				url:     fmt.Sprintf("/%d/", i),
+				content: `{{T "hello"}} {{checklink "/missing/"}} {{container "x"}} {{renderPageByURL "/other/"}}`,
+				meta:    map[string]interface{}{"lang": lang, "title": fmt.Sprint(i)},
+			}
+			r, err := c.RenderPageResult(p, "default")
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			results[i] = r.Output
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < n; i++ {
+		if errs[i] != nil {
+			t.Fatalf("%d: %s", i, errs[i])
+		}
+		hello := "Hello"
+		if i%2 == 1 {
+			hello = "Bonjour"
+		}
+		exp := fmt.Sprintf(`<html><header>%d</header>%s /missing/ <div class="container">x</div> Bonjour<footer>%s</footer></html>`, i, hello, hello)
+		if results[i] != exp {
+			t.Errorf("%d: expected %q, got %q", i, exp, results[i])
+		}
+	}
+	if m := c.LayoutMetrics()["default"]; m.Count != n {
+		t.Errorf("expected %d rendered pages, got %d", n, m.Count)
+	}
+	if w := c.Warnings(); len(w) != n {
+		t.Errorf("expected %d warnings, got %d", n, len(w))
+	}
+	if urls := c.PagesUsingInclude("header"); len(urls) != n {
+		t.Errorf("expected %d pages using include, got %d", n, len(urls))
+	}
+}
+
+func TestLayoutByLength(t *testing.T) {
+	c := newTestCollection()
+	addLayout(t, c, "default", "none", "<html>{{.Content}}</html>")
+	addLayout(t, c, "note", "default", "<aside>{{.Content}}</aside>")
+	addLayout(t, c, "post", "default", "<article>{{.Content}}</article>")
+	c.SetLayoutByLength(map[string]int{"note": 0, "post": 5})
+	long := "<p>This is a long post with many words.</p>"
+	var tests = []struct {
+		page *testPage
+		out  string
+	}{
+		{&testPage{url: "/short/", content: "Short note.", meta: map[string]interface{}{}}, "<html><aside>Short note.</aside></html>"},
+		{&testPage{url: "/long/", content: long, meta: map[string]interface{}{}}, "<html><article>" + long + "</article></html>"},
+		{&testPage{url: "/explicit/", content: "Short.", meta: map[string]interface{}{"layout": "post"}}, "<html><article>Short.</article></html>"},
+	}
+	for i, v := range tests {
+		out, err := c.RenderPage(v.page, "default")
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		if out != v.out {
+			t.Errorf("%d: expected %q, got %q", i, v.out, out)
+		}
+	}
+	c.SetLayoutByLength(map[string]int{"post": 5})
+	out, err := c.RenderPage(&testPage{url: "/other/", content: "Short.", meta: map[string]interface{}{}}, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := "<html>Short.</html>"; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+}
+
+func TestAddArchive(t *testing.T) {
+	files := []struct{ name, content string }{
+		{"theme/base.html", "<html>{{.Content}}</html>"},
+		{"theme/post.html", "---\nlayout: base\n---\n<article>{{.Content}}</article>"},
+		{"theme/old.html", "{{html .Content}}"},
+		{"__MACOSX/theme/._post.html", "\x00\x05\x16\x07{{"},
+		{"theme/.hidden/post.html", "{{"},
+	}
+	var zbuf bytes.Buffer
+	zw := zip.NewWriter(&zbuf)
+	var tbuf bytes.Buffer
+	tw := tar.NewWriter(&tbuf)
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		io.WriteString(w, f.content)
+		tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.content))})
+		io.WriteString(tw, f.content)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	zc := newTestCollection()
+	zc.SetDeprecatedFuncs(map[string]string{"html": "use `escape`"})
+	if err := zc.AddArchive(bytes.NewReader(zbuf.Bytes()), int64(zbuf.Len())); err != nil {
+		t.Fatalf("%s", err)
+	}
+	tc := newTestCollection()
+	tc.SetDeprecatedFuncs(map[string]string{"html": "use `escape`"})
+	if err := tc.AddTar(&tbuf); err != nil {
+		t.Fatalf("%s", err)
+	}
+	for i, c := range []*Collection{zc, tc} {
+		var skipped, deprecated []string
+		for _, w := range c.Warnings() {
+			switch w.Category {
+			case SkippedWarning:
+				skipped = append(skipped, w.Filename)
+			case DeprecatedWarning:
+				deprecated = append(deprecated, w.Filename)
+			}
+		}
+		if exp := []string{"__MACOSX/theme/._post.html", "theme/.hidden/post.html"}; !reflect.DeepEqual(skipped, exp) {
+			t.Errorf("%d: expected skipped %q, got %q", i, exp, skipped)
+		}
+		if exp := []string{"theme/old.html"}; !reflect.DeepEqual(deprecated, exp) {
+			t.Errorf("%d: expected deprecated %q, got %q", i, exp, deprecated)
+		}
+		out, err := c.RenderPage(&testPage{content: "Hello"}, "post")
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		if exp := "<html><article>Hello</article></html>"; out != exp {
+			t.Errorf("%d: expected %q, got %q", i, exp, out)
+		}
+	}
+}
+
+func TestIncludeFallback(t *testing.T) {
+	theme := newTestCollection()
+	theme.AddInclude("card", "theme card")
+	theme.AddInclude("footer", "theme footer")
+	c := newTestCollection()
+	c.AddInclude("footer", "site footer")
+	c.SetIncludeFallback(theme)
+	theme.SetIncludeFallback(c) // cycles must not hang
+	out := renderString(t, c, `{{include "card"}}, {{include "footer"}}`)
+	if exp := "theme card, site footer"; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+	if _, err := c.include(nil, "missing"); err == nil {
+		t.Errorf("expected error for missing include")
+	}
+}
+
+func TestMaxLayoutDepth(t *testing.T) {
+	c := newTestCollection()
+	addLayout(t, c, "l1", "none", "1{{.Content}}")
+	addLayout(t, c, "l2", "l1", "2{{.Content}}")
+	addLayout(t, c, "l3", "l2", "3{{.Content}}")
+	addLayout(t, c, "loop", "loop", "{{.Content}}")
+	c.SetMaxLayoutDepth(3)
+	out, err := c.RenderPage(&testPage{content: "x"}, "l3")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if out != "123x" {
+		t.Errorf("expected %q, got %q", "123x", out)
+	}
+	c.SetMaxLayoutDepth(2)
+	if _, err := c.RenderPage(&testPage{content: "x"}, "l3"); err == nil {
+		t.Errorf("expected error for chain exceeding maximum depth")
+	}
+	if _, err := c.RenderPage(&testPage{content: "x"}, "loop"); err == nil {
+		t.Errorf("expected error for cyclic layout")
+	}
+}
+
+func TestRenderResultLines(t *testing.T) {
+	c := newTestCollection()
+	var observed *RenderResult
+	c.SetRenderObserver(func(p PageContext, r *RenderResult) {
+		observed = r
+	})
+	var tests = []struct {
+		in    string
+		lines int
+	}{
+		{"", 0},
+		{"one", 1},
+		{"one\ntwo\nthree\n", 3},
+		{"one\n\nthree", 3},
+	}
+	for i, v := range tests {
+		r, err := c.RenderPageResult(&testPage{content: v.in}, "none")
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		if r.Lines != v.lines {
+			t.Errorf("%d: expected %d lines, got %d", i, v.lines, r.Lines)
+		}
+		if observed != r {
+			t.Errorf("%d: observer didn't receive result", i)
+		}
+	}
+}
+
+func TestAssetRewriter(t *testing.T) {
+	c := newTestCollection()
+	c.SetAssetRewriter(func(path string) string {
+		if strings.HasPrefix(path, "/assets/") {
+			return "https://cdn.example.com" + path
+		}
+		return path
+	})
+	in := `<link rel="stylesheet" href="/assets/main.css">
+<img src='/assets/logo.png' alt="Logo"/>
+<a href="/about/">About</a> <a href="http://example.org/assets/x.png">x</a>
+<script src="//other.example.com/assets/lib.js"></script>`
+	exp := `<link rel="stylesheet" href="https://cdn.example.com/assets/main.css">
+<img src="https://cdn.example.com/assets/logo.png" alt="Logo"/>
+<a href="/about/">About</a> <a href="http://example.org/assets/x.png">x</a>
+<script src="//other.example.com/assets/lib.js"></script>`
+	out, err := c.RenderPage(&testPage{url: "/index.html", content: in}, "none")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if out != exp {
+		t.Errorf("expected\n%s\ngot\n%s", exp, out)
+	}
+	// Non-HTML output is left untouched.
+	out, err = c.RenderPage(&testPage{url: "/feed.xml", content: in}, "none")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if out != in {
+		t.Errorf("expected non-HTML output untouched, got\n%s", out)
+	}
+}
+
+func TestExtendsConflictPolicy(t *testing.T) {
+	c := newTestCollection()
+	addLayout(t, c, "a", "none", "a:{{.Content}}")
+	addLayout(t, c, "b", "none", "b:{{.Content}}")
+	both := &testPage{meta: map[string]interface{}{"layout": "a", "extends": "b"}, content: "x"}
+	if _, err := c.RenderPage(both, "none"); err == nil {
+		t.Errorf("expected error by default")
+	}
+	var tests = []struct {
+		policy ExtendsConflictPolicy
+		out    string
+	}{
+		{ExtendsWins, "b:x"},
+		{LayoutWins, "a:x"},
+	}
+	for i, v := range tests {
+		c.SetExtendsConflictPolicy(v.policy)
+		out, err := c.RenderPage(both, "none")
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		if out != v.out {
+			t.Errorf("%d: expected %q, got %q", i, v.out, out)
+		}
+	}
+	c.SetExtendsConflictPolicy(ExtendsConflictError)
+	out, err := c.RenderPage(&testPage{meta: map[string]interface{}{"extends": "b"}, content: "x"}, "none")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if out != "b:x" {
+		t.Errorf("expected %q, got %q", "b:x", out)
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	c := newTestCollection()
+	addLayout(t, c, "default", "none", "<div>{{.Content}}</div>")
+	c.SetSanitizer(strings.NewReplacer("<b>", "", "</b>", "").Replace)
+	p := &testPage{content: `{{print "<" "b>x<" "/b>"}} *y*`}
+	var tests = []struct {
+		stages []Stage
+		out    string
+	}{
+		{DefaultPipeline, "<div><b>x</b> *y*</div>"},
+		{[]Stage{SanitizeStage, TemplateStage, LayoutStage}, "<div><b>x</b> *y*</div>"},
+		{[]Stage{TemplateStage, SanitizeStage, LayoutStage}, "<div>x *y*</div>"},
+		{[]Stage{TemplateStage, MarkdownStage, LayoutStage}, "<div><p><b>x</b> <em>y</em></p>\n</div>"},
+	}
+	for i, v := range tests {
+		if err := c.SetPipeline(v.stages); err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		out, err := c.RenderPage(p, "default")
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		if out != v.out {
+			t.Errorf("%d: expected %q, got %q", i, v.out, out)
+		}
+	}
+	if err := c.SetPipeline([]Stage{"shortcodes"}); err == nil {
+		t.Errorf("expected error for unknown stage")
+	}
+}
+
+func TestRenderResultPartials(t *testing.T) {
+	c := newTestCollection()
+	c.AddInclude("header", "H")
+	c.AddInclude("footer", "F")
+	c.AddInclude("unused", "U")
+	addLayout(t, c, "default", "none", `{{include "header"}}{{.Content}}{{include "footer"}}`)
+	r, err := c.RenderPageResult(&testPage{url: "/a/", content: `{{include "header"}}a`}, "default")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if exp := []string{"footer", "header"}; strings.Join(r.Partials, ",") != strings.Join(exp, ",") {
+		t.Errorf("expected %q, got %q", exp, r.Partials)
+	}
+	if _, err := c.RenderPage(&testPage{url: "/b/", content: "b"}, "none"); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if urls := c.PagesUsingInclude("header"); len(urls) != 1 || urls[0] != "/a/" {
+		t.Errorf("expected [/a/], got %q", urls)
+	}
+}
+
+func TestServePage(t *testing.T) {
+	c := newTestCollection()
+	addLayout(t, c, "default", "none", `<p>{{.Content}}</p>`)
+	page := &testPage{url: "/a/", content: "hello"}
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/a/", nil)
+	if err := c.ServePage(w, r, page, "default"); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if exp := "<p>hello</p>"; w.Body.String() != exp {
+		t.Errorf("expected %q, got %q", exp, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	etag := w.Header().Get("ETag")
+	if etag != ETag("<p>hello</p>") {
+		t.Errorf("unexpected ETag %q", etag)
+	}
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/a/", nil)
+	r.Header.Set("If-None-Match", `"other", `+etag)
+	if err := c.ServePage(w, r, page, "default"); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("expected empty body, got %q", w.Body.String())
+	}
+}
+
+func TestRenderContent(t *testing.T) {
+	c := newTestCollection()
+	addLayout(t, c, "default", "none", `<main>{{.Content}}</main>`)
+	addLayout(t, c, "post", "default", `<article>{{.Content}}</article>`)
+	page := &testPage{
+		meta:    map[string]interface{}{"layout": "post", "title": "Hi"},
+		url:     "/a/",
+		content: `<h1>{{.Page.title}}</h1>`,
+	}
+	full, err := c.RenderPage(page, "default")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if exp := "<main><article><h1>Hi</h1></article></main>"; full != exp {
+		t.Errorf("full: expected %q, got %q", exp, full)
+	}
+	content, err := c.RenderContent(page)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if exp := "<h1>Hi</h1>"; content != exp {
+		t.Errorf("content: expected %q, got %q", exp, content)
+	}
+
+	if err := c.SetPipeline([]Stage{MarkdownStage, LayoutStage}); err != nil {
+		t.Fatalf("%s", err)
+	}
+	content, err = c.RenderContent(&testPage{url: "/b/", content: "*x*"})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if exp := "<p><em>x</em></p>\n"; content != exp {
+		t.Errorf("markdown: expected %q, got %q", exp, content)
+	}
+}
+
+func TestHeadingAnchors(t *testing.T) {
+	c := newTestCollection()
+	c.SetHeadingAnchors(true)
+	page := &testPage{url: "/a/", content: `<h1>Title</h1>
+<h2>Intro &amp; Setup</h2>
+<h3 id="custom">Custom</h3>
+<h2>Intro &amp; Setup</h2>
+<h4><code>Code</code> here</h4>
+<h5>Deep</h5>`}
+	out, err := c.RenderPage(page, "none")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	exp := `<h1>Title</h1>
+<h2 id="intro-setup">Intro &amp; Setup<a class="anchor" href="#intro-setup">#</a></h2>
+<h3 id="custom">Custom<a class="anchor" href="#custom">#</a></h3>
+<h2 id="intro-setup-1">Intro &amp; Setup<a class="anchor" href="#intro-setup-1">#</a></h2>
+<h4 id="code-here"><code>Code</code> here<a class="anchor" href="#code-here">#</a></h4>
+<h5>Deep</h5>`
+	if out != exp {
+		t.Errorf("expected\n%s\ngot\n%s", exp, out)
+	}
+}
+
+func TestVCSInfo(t *testing.T) {
+	c := NewCollection(&testSite{data: map[string]interface{}{"title": "Site"}, funcs: FuncMap{}})
+	c.SetVCSInfo(VCSInfo{Commit: "abc123", Branch: "master", Dirty: true})
+	out := renderString(t, c, `{{.Site.title}} {{.Site.vcs.commit}} {{.Site.vcs.branch}}{{if .Site.vcs.dirty}}+{{end}} {{vcs.commit}}`)
+	if exp := "Site abc123 master+ abc123"; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+}
+
+func TestSiteStats(t *testing.T) {
+	c := NewCollection(&testSite{data: map[string]interface{}{}})
+	if out := renderString(t, c, `{{with .Site.stats}}stats{{end}}`); out != "" {
+		t.Errorf("expected no stats, got %q", out)
+	}
+	c.SetSiteStats(map[string]interface{}{"pageCount": 42, "totalWords": 1000})
+	if out := renderString(t, c, `{{.Site.stats.pageCount}} {{.Site.stats.totalWords}}`); out != "42 1000" {
+		t.Errorf("expected %q, got %q", "42 1000", out)
+	}
+}
+
+type namedSiteData map[string]interface{}
+
+func (d namedSiteData) Greet(name string) string { return "Hello, " + name }
+
+func TestVCSInfoNamedMap(t *testing.T) {
+	c := NewCollection(&testSite{data: namedSiteData{"URL": "http://example.com"}})
+	c.SetVCSInfo(VCSInfo{Commit: "abc123"})
+	out := renderString(t, c, `{{.Site.Greet "you"}} {{.Site.vcs.commit}}`)
+	if exp := "Hello, you abc123"; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+	if url := siteField(c.siteData(), "url"); url != "http://example.com" {
+		t.Errorf("expected site URL, got %q", url)
+	}
+	// Other site data is unchanged.
+	c = NewCollection(&testSite{data: struct{ Name string }{"Site"}})
+	c.SetVCSInfo(VCSInfo{Commit: "abc123"})
+	if out := renderString(t, c, `{{.Site.Name}}`); out != "Site" {
+		t.Errorf("expected %q, got %q", "Site", out)
+	}
+}
+
+func TestIncludeFrom(t *testing.T) {
+	web := newTestCollection()
+	email := newTestCollection()
+	email.LinkCollection("web", web)
+	web.LinkCollection("email", email)
+	web.AddInclude("footer", `<footer>{{.Page.title}}</footer>`)
+	addLayout(t, email, "default", "none", `<body>{{.Content}}{{includeFrom "web" "footer" .}}</body>`)
+	out, err := email.RenderPage(&testPage{meta: map[string]interface{}{"title": "Hello"}, url: "/a/", content: "Hi"}, "default")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if exp := "<body>Hi<footer>Hello</footer></body>"; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+
+	web.AddInclude("loop", `{{includeFrom "email" "loop"}}`)
+	email.AddInclude("loop", `{{includeFrom "web" "loop"}}`)
+	if _, err := email.RenderPage(&testPage{url: "/b/", content: `{{includeFrom "web" "loop"}}`}, "none"); err == nil {
+		t.Errorf("expected error for cycle across collections")
+	}
+	if _, err := email.RenderPage(&testPage{url: "/c/", content: `{{includeFrom "print" "footer"}}`}, "none"); err == nil {
+		t.Errorf("expected error for unlinked collection")
+	}
+}
+
+func TestRecoverFuncPanics(t *testing.T) {
+	c := NewCollection(&testSite{funcs: FuncMap{
+		"boom": func() string { panic("boom") },
+	}})
+	c.SetRecoverFuncPanics(true)
+	addLayout(t, c, "default", "none", `<main>{{boom}}</main>`)
+	_, err := c.RenderPage(&testPage{url: "/a/", content: "x"}, "default")
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	re, ok := err.(*RenderError)
+	if !ok {
+		t.Fatalf("expected *RenderError, got %T: %s", err, err)
+	}
+	if re.URL != "/a/" || re.Layout != "default" {
+		t.Errorf("unexpected page or layout in error: %s", err)
+	}
+	if !strings.Contains(err.Error(), "boom") {
+		t.Errorf("error doesn't mention panic: %s", err)
+	}
+	// Other pages still render.
+	if out := renderString(t, c, "ok"); out != "ok" {
+		t.Errorf("expected %q, got %q", "ok", out)
+	}
+
+	// Panic outside of template function call.
+	c = NewCollection(panicSite{})
+	c.SetRecoverFuncPanics(true)
+	addLayout(t, c, "default", "none", `<main>{{.Content}}</main>`)
+	_, err = c.RenderPage(&testPage{url: "/b/", content: "x"}, "default")
+	if re, ok := err.(*RenderError); !ok || re.URL != "/b/" || !strings.Contains(err.Error(), "panic: site data") {
+		t.Errorf("expected *RenderError with panic, got %T: %v", err, err)
+	}
+}
+
+type panicSite struct{}
+
+func (panicSite) LayoutData() interface{} { panic("site data") }
+func (panicSite) LayoutFuncs() FuncMap    { return nil }
+
+func TestWarnings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "layouts-test-")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"default.html": `{{if true}}{{oldDate .Page.date}}{{end}}{{.Content}}`,
+		".DS_Store":    "junk",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("%s", err)
+		}
+	}
+	c := NewCollection(&testSite{funcs: FuncMap{
+		"oldDate": func(interface{}) string { return "" },
+	}})
+	c.SetDeprecatedFuncs(map[string]string{"oldDate": "use localizeDate"})
+	if err := c.AddDir(dir); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if _, ok := c.layouts[".DS_Store"]; ok {
+		t.Errorf("dotfile loaded as layout")
+	}
+	exp := []Warning{
+		{DeprecatedWarning, `function "oldDate" is deprecated: use localizeDate`, filepath.Join(dir, "default.html")},
+		{SkippedWarning, "skipped dotfile", filepath.Join(dir, ".DS_Store")},
+	}
+	w := c.Warnings()
+	if len(w) != len(exp) {
+		t.Fatalf("expected %d warnings, got %v", len(exp), w)
+	}
+	for _, e := range exp {
+		found := false
+		for _, x := range w {
+			if x == e {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("warning %v not found in %v", e, w)
+		}
+	}
+	// Reloaded layouts don't duplicate warnings.
+	if _, err := c.Rebuild([]string{filepath.Join(dir, "default.html")}); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if w := c.Warnings(); len(w) != len(exp) {
+		t.Errorf("expected %d warnings after rebuild, got %v", len(exp), w)
+	}
+}
+
+func TestEmptyBodyFallback(t *testing.T) {
+	c := newTestCollection()
+	c.SetEmptyBodyFallback(`<p>{{.Page.title}} is coming soon.</p>`)
+	addLayout(t, c, "default", "none", `<main>{{.Content}}</main>`)
+	meta := map[string]interface{}{"title": "Shop"}
+	out, err := c.RenderPage(&testPage{meta: meta, url: "/empty/", content: "\n"}, "default")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if exp := "<main><p>Shop is coming soon.</p></main>"; out != exp {
+		t.Errorf("empty: expected %q, got %q", exp, out)
+	}
+	out, err = c.RenderPage(&testPage{meta: meta, url: "/full/", content: "Open"}, "default")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if exp := "<main>Open</main>"; out != exp {
+		t.Errorf("non-empty: expected %q, got %q", exp, out)
+	}
+}
+
+func TestInvalidateTag(t *testing.T) {
+	EnableCache(true)
+	defer EnableCache(false)
+	fi, err := os.Stat("layouts_test.go")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	renders := 0
+	c := NewCollection(&testSite{funcs: FuncMap{
+		"count": func() string { renders++; return "" },
+	}})
+	pages := []*testPage{
+		{meta: map[string]interface{}{"cache_tags": []interface{}{"category:go", "lang:en"}}, url: "/go/1/", content: "{{count}}", fi: fi},
+		{meta: map[string]interface{}{"cache_tags": []interface{}{"category:go"}}, url: "/go/2/", content: "{{count}}", fi: fi},
+		{meta: map[string]interface{}{"cache_tags": []interface{}{"lang:en"}}, url: "/other/", content: "{{count}}", fi: fi},
+	}
+	renderAll := func() {
+		for _, p := range pages {
+			if _, err := c.RenderPage(p, "none"); err != nil {
+				t.Fatalf("%s", err)
+			}
+		}
+	}
+	renderAll()
+	renderAll()
+	if renders != 3 {
+		t.Fatalf("expected 3 renders, got %d", renders)
+	}
+	urls := InvalidateTag("category:go")
+	if len(urls) != 2 || urls[0] != "/go/1/" || urls[1] != "/go/2/" {
+		t.Errorf("unexpected invalidated pages: %q", urls)
+	}
+	renderAll()
+	if renders != 5 {
+		t.Errorf("expected 5 renders, got %d", renders)
+	}
+	if urls := InvalidateTag("category:none"); len(urls) != 0 {
+		t.Errorf("unexpected invalidated pages: %q", urls)
+	}
+}
+
+func TestOutputPath(t *testing.T) {
+	var tests = []struct {
+		url          string
+		pretty, ugly string
+	}{
+		{"/", "index.html", "index.html"},
+		{"/about/", "about/index.html", "about.html"},
+		{"/about", "about/index.html", "about.html"},
+		{"/about.html", "about.html", "about.html"},
+		{"/blog/2016/post/", "blog/2016/post/index.html", "blog/2016/post.html"},
+		{"/feed.xml", "feed.xml", "feed.xml"},
+		{"/../etc/x.html", "etc/x.html", "etc/x.html"},
+	}
+	c := newTestCollection()
+	for _, v := range tests {
+		if out := c.OutputPath(v.url); out != filepath.FromSlash(v.pretty) {
+			t.Errorf("pretty %q: expected %q, got %q", v.url, v.pretty, out)
+		}
+	}
+	c.SetPrettyURLs(false)
+	for _, v := range tests {
+		if out := c.OutputPath(v.url); out != filepath.FromSlash(v.ugly) {
+			t.Errorf("ugly %q: expected %q, got %q", v.url, v.ugly, out)
+		}
+	}
+}
+
+func TestPostProcessor(t *testing.T) {
+	c := newTestCollection()
+	addLayout(t, c, "page", "none", "<p>  {{.Content}}  </p>\n")
+	c.layouts["page"].Filename = "layouts/page.html"
+	addLayout(t, c, "feed", "none", "<feed>{{.Content}}</feed>")
+	c.layouts["feed"].Filename = "layouts/feed.xml"
+	c.SetPostProcessor(".html", func(b []byte) ([]byte, error) {
+		return bytes.Join(bytes.Fields(b), nil), nil
+	})
+	c.SetPostProcessor(".xml", func(b []byte) ([]byte, error) {
+		return append([]byte(`<?xml version="1.0"?>`+"\n"), b...), nil
+	})
+	var tests = []struct {
+		layout, out string
+	}{
+		{"page", "<p>x</p>"},
+		{"feed", "<?xml version=\"1.0\"?>\n<feed>x</feed>"},
+	}
+	for _, v := range tests {
+		out, err := c.RenderPage(&testPage{url: "/" + v.layout + "/", content: "x"}, v.layout)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if out != v.out {
+			t.Errorf("%s: expected %q, got %q", v.layout, v.out, out)
+		}
+	}
+	c.SetPostProcessor(".xml", func(b []byte) ([]byte, error) {
+		return nil, fmt.Errorf("bad xml")
+	})
+	if _, err := c.RenderPage(&testPage{url: "/f/", content: "x"}, "feed"); err == nil {
+		t.Errorf("expected post-processor error")
+	}
+}
+
+func TestImplicitParent(t *testing.T) {
+	c := newTestCollection()
+	c.SetImplicitParent("base")
+	addLayout(t, c, "base", "", "<html>{{.Content}}</html>")
+	addLayout(t, c, "page", "", "<main>{{.Content}}</main>")
+	addLayout(t, c, "raw", "none", "<raw>{{.Content}}</raw>")
+	var tests = []struct {
+		layout, out string
+	}{
+		{"page", "<html><main>x</main></html>"},
+		{"raw", "<raw>x</raw>"},
+		{"base", "<html>x</html>"},
+	}
+	for _, v := range tests {
+		out, err := c.RenderPage(&testPage{url: "/" + v.layout + "/", content: "x"}, v.layout)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if out != v.out {
+			t.Errorf("%s: expected %q, got %q", v.layout, v.out, out)
+		}
+	}
+}
+
+func TestExposeDebugConfig(t *testing.T) {
+	c := NewCollection(&testSite{data: map[string]interface{}{}, funcs: FuncMap{}})
+	tmpl := `{{with .Site.debug}}{{.config.engine}} {{.config.renderCache}}{{else}}hidden{{end}}`
+	if out := renderString(t, c, tmpl); out != "hidden" {
+		t.Errorf("expected config to be hidden, got %q", out)
+	}
+	c.SetExposeDebugConfig(true)
+	if out, exp := renderString(t, c, tmpl), "text/template false"; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+}
+
+func TestLayoutNoCache(t *testing.T) {
+	EnableCache(true)
+	defer EnableCache(false)
+	dir, err := ioutil.TempDir("", "layouts-test-")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"stats.html":  "---\ncache: false\n---\n{{count}}{{.Content}}",
+		"page.html":   "{{count}}{{.Content}}",
+		"widget.html": "---\nlayout: stats\n---\n{{.Content}}",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("%s", err)
+		}
+	}
+	renders := 0
+	c := NewCollection(&testSite{funcs: FuncMap{
+		"count": func() string { renders++; return "" },
+	}})
+	if err := c.AddDir(dir); err != nil {
+		t.Fatalf("%s", err)
+	}
+	fi, err := os.Stat("layouts_test.go")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	var tests = []struct {
+		layout  string
+		renders int
+	}{
+		{"page", 1},   // cached after first render
+		{"stats", 3},  // never cached
+		{"widget", 3}, // parent layout is never cached
+	}
+	for _, v := range tests {
+		renders = 0
+		page := &testPage{meta: map[string]interface{}{"cache": true}, url: "/" + v.layout + "/", content: "x", fi: fi}
+		for i := 0; i < 3; i++ {
+			if _, err := c.RenderPage(page, v.layout); err != nil {
+				t.Fatalf("%s", err)
+			}
+		}
+		if renders != v.renders {
+			t.Errorf("%s: expected %d renders, got %d", v.layout, v.renders, renders)
+		}
+	}
+}
+
+func TestDraftWatermark(t *testing.T) {
+	c := newTestCollection()
+	c.SetDraftWatermarkHTML(`<div>DRAFT</div>`)
+	addLayout(t, c, "default", "none", "<html><body>{{.Content}}</body></html>")
+	draft := &testPage{meta: map[string]interface{}{"draft": true}, url: "/draft/", content: "x"}
+	published := &testPage{url: "/published/", content: "x"}
+	var tests = []struct {
+		dev  bool
+		page *testPage
+		out  string
+	}{
+		{true, draft, "<html><body>x<div>DRAFT</div></body></html>"},
+		{true, published, "<html><body>x</body></html>"},
+		{false, draft, "<html><body>x</body></html>"},
+	}
+	for i, v := range tests {
+		c.SetDevMode(v.dev)
+		out, err := c.RenderPage(v.page, "default")
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		if out != v.out {
+			t.Errorf("%d: expected %q, got %q", i, v.out, out)
+		}
+	}
+	c.SetDraftWatermark(false)
+	c.SetDevMode(true)
+	if out, _ := c.RenderPage(draft, "default"); strings.Contains(out, "DRAFT") {
+		t.Errorf("watermark added when disabled: %q", out)
+	}
+}
+
+func TestTypographer(t *testing.T) {
+	c := newTestCollection()
+	page := &testPage{url: "/a/", content: `<p>"Hello," she said -- it's "fine"...</p><code>x := "y"</code><pre>'a'</pre>`}
+	out, err := c.RenderPage(page, "none")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if out != page.content {
+		t.Errorf("changed without typographer: %q", out)
+	}
+	c.SetTypographer(SmartyPants)
+	out, err = c.RenderPage(page, "none")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	exp := "<p>“Hello,” she said – it’s “fine”…</p><code>x := \"y\"</code><pre>'a'</pre>"
+	if out != exp {
+		t.Errorf("expected\n%s\ngot\n%s", exp, out)
+	}
+	var tests = []struct{ in, out string }{
+		{`<p>&quot;hi&quot; &amp; &lt;bye&gt;</p>`, "<p>“hi” &amp; &lt;bye&gt;</p>"},
+		{`<p>"<em>hi</em>" ok</p>`, "<p>“<em>hi</em>” ok</p>"},
+		{`<p>it<br>"a"</p><p>x</p><p>"b"</p>`, "<p>it<br>“a”</p><p>x</p><p>“b”</p>"},
+	}
+	for i, v := range tests {
+		out, err := c.RenderPage(&testPage{url: "/b/", content: v.in}, "none")
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		if out != v.out {
+			t.Errorf("%d: expected %q, got %q", i, v.out, out)
+		}
+	}
+}
+
+func TestBuildID(t *testing.T) {
+	newSite := func() *Collection {
+		c := NewCollection(&testSite{data: map[string]interface{}{}, funcs: FuncMap{}})
+		c.AddInclude("footer", "F")
+		addLayout(t, c, "default", "none", "<main>{{.Content}}</main>")
+		c.SetBuildID("")
+		return c
+	}
+	a, b := newSite(), newSite()
+	idA := renderString(t, a, "{{.Site.buildID}}")
+	if idA == "" {
+		t.Fatalf("empty build id")
+	}
+	if idB := renderString(t, b, "{{buildID}}"); idA != idB {
+		t.Errorf("different build ids for identical sources: %q and %q", idA, idB)
+	}
+	b.AddInclude("footer", "changed")
+	if idB := renderString(t, b, "{{.Site.buildID}}"); idA == idB {
+		t.Errorf("same build id for different sources")
+	}
+	b.SetBuildID("release-42")
+	if out := renderString(t, b, "{{.Site.buildID}}"); out != "release-42" {
+		t.Errorf("expected %q, got %q", "release-42", out)
+	}
+	// Reloaded layouts change build id.
+	dir, err := ioutil.TempDir("", "layouts-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "page.html")
+	if err := ioutil.WriteFile(filename, []byte("<p>{{.Content}}</p>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.AddFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	idA = a.BuildID()
+	if err := ioutil.WriteFile(filename, []byte("<div>{{.Content}}</div>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Rebuild([]string{filename}); err != nil {
+		t.Fatal(err)
+	}
+	if a.BuildID() == idA {
+		t.Errorf("build id not changed after rebuild")
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright 2013 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package layouts
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultLocale is the locale used when no other locale is set.
+const DefaultLocale = "en"
+
+type locale struct {
+	months      [12]string
+	shortMonths [12]string
+	days        [7]string
+	shortDays   [7]string
+	decimal     string
+	group       string
+}
+
+// locales contains names and number separators of supported locales.
+//
+// Unlike golang.org/x/text, which is not vendored and has no month
+// and weekday names, only these locales are known: en, de, fr, es, ru.
+// Dates are formatted with genitive month names where the language uses
+// them (ru), but no other CLDR rules, such as plural forms or locale
+// date order, are applied. Other locales fall back to the default one.
+var locales = map[string]*locale{
+	"en": {
+		months:      [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+		shortMonths: [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+		days:        [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+		shortDays:   [7]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"},
+		decimal:     ".",
+		group:       ",",
+	},
+	"de": {
+		months:      [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+		shortMonths: [12]string{"Jan", "Feb", "Mär", "Apr", "Mai", "Jun", "Jul", "Aug", "Sep", "Okt", "Nov", "Dez"},
+		days:        [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+		shortDays:   [7]string{"So", "Mo", "Di", "Mi", "Do", "Fr", "Sa"},
+		decimal:     ",",
+		group:       ".",
+	},
+	"fr": {
+		months:      [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		shortMonths: [12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+		days:        [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+		shortDays:   [7]string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+		decimal:     ",",
+		group:       " ",
+	},
+	"es": {
+		months:      [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		shortMonths: [12]string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sept", "oct", "nov", "dic"},
+		days:        [7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+		shortDays:   [7]string{"dom", "lun", "mar", "mié", "jue", "vie", "sáb"},
+		decimal:     ",",
+		group:       ".",
+	},
+	"ru": {
+		months:      [12]string{"января", "февраля", "марта", "апреля", "мая", "июня", "июля", "августа", "сентября", "октября", "ноября", "декабря"},
+		shortMonths: [12]string{"янв", "фев", "мар", "апр", "мая", "июн", "июл", "авг", "сен", "окт", "ноя", "дек"},
+		days:        [7]string{"воскресенье", "понедельник", "вторник", "среда", "четверг", "пятница", "суббота"},
+		shortDays:   [7]string{"вс", "пн", "вт", "ср", "чт", "пт", "сб"},
+		decimal:     ",",
+		group:       " ",
+	},
+}
+
+// SetDefaultLocale sets the locale used by localization
+// functions when the requested locale is unknown.
+func (c *Collection) SetDefaultLocale(name string) {
+	c.defaultLocale = name
+}
+
+// SetTranslations sets message catalog for the given locale,
+// which is used by `T` template function.
+func (c *Collection) SetTranslations(localeName string, messages map[string]string) {
+	c.translations[strings.ToLower(localeName)] = messages
+}
+
+// SetStrictTranslations sets whether `T` returns an error for
+// messages missing from catalog instead of returning their keys.
+func (c *Collection) SetStrictTranslations(strict bool) {
+	c.strictTranslations = strict
+}
+
+// currentLocale returns the name of locale used for rendering
+// with the given state, which can be nil.
+func (c *Collection) currentLocale(st *renderState) string {
+	if st != nil && st.locale != "" {
+		return st.locale
+	}
+	return c.defaultLocale
+}
+
+// translate returns message for key from catalog of the current locale.
+// If args are given, message is used as a format string for them.
+func (c *Collection) translate(st *renderState, key string, args ...interface{}) (string, error) {
+	msg, ok := c.message(st, key)
+	if !ok {
+		if c.strictTranslations {
+			return "", fmt.Errorf("translation %q not found for locale %q", key, strings.ToLower(c.currentLocale(st)))
+		}
+		msg = key
+	}
+	if len(args) > 0 {
+		msg = fmt.Sprintf(msg, args...)
+	}
+	return msg, nil
+}
+
+// message returns message for key from catalog of the current locale
+// and reports whether it was found.
+func (c *Collection) message(st *renderState, key string) (string, bool) {
+	name := strings.ToLower(c.currentLocale(st))
+	messages, ok := c.translations[name]
+	if !ok {
+		if i := strings.Index(name, "-"); i > 0 {
+			messages = c.translations[name[:i]]
+		}
+	}
+	msg, ok := messages[key]
+	return msg, ok
+}
+
+// findLocale returns locale by name (such as "fr" or "fr-CA"),
+// falling back to the default locale.
+func (c *Collection) findLocale(name string) *locale {
+	name = strings.ToLower(strings.Replace(name, "_", "-", -1))
+	if l, ok := locales[name]; ok {
+		return l
+	}
+	if i := strings.Index(name, "-"); i > 0 {
+		if l, ok := locales[name[:i]]; ok {
+			return l
+		}
+	}
+	if l, ok := locales[c.defaultLocale]; ok {
+		return l
+	}
+	return locales[DefaultLocale]
+}
+
+// localizeDate formats time according to layout (as in time.Format),
+// using month and weekday names from the given locale.
+func (c *Collection) localizeDate(t time.Time, localeName, layout string) string {
+	l := c.findLocale(localeName)
+	names := []struct {
+		token string
+		value string
+	}{
+		// Longer tokens must go first.
+		{"January", l.months[t.Month()-1]},
+		{"Jan", l.shortMonths[t.Month()-1]},
+		{"Monday", l.days[t.Weekday()]},
+		{"Mon", l.shortDays[t.Weekday()]},
+	}
+	var out []byte
+	start := 0
+outer:
+	for i := 0; i < len(layout); i++ {
+		for _, v := range names {
+			if strings.HasPrefix(layout[i:], v.token) {
+				out = t.AppendFormat(out, layout[start:i])
+				out = append(out, v.value...)
+				i += len(v.token) - 1
+				start = i + 1
+				continue outer
+			}
+		}
+	}
+	out = t.AppendFormat(out, layout[start:])
+	return string(out)
+}
+
+// localizeNumber formats number using decimal and
+// grouping separators from the given locale.
+func (c *Collection) localizeNumber(n interface{}, localeName string) (string, error) {
+	var s string
+	switch x := n.(type) {
+	case int:
+		s = strconv.Itoa(x)
+	case int64:
+		s = strconv.FormatInt(x, 10)
+	case float64:
+		s = strconv.FormatFloat(x, 'f', -1, 64)
+	case float32:
+		s = strconv.FormatFloat(float64(x), 'f', -1, 32)
+	default:
+		return "", fmt.Errorf("localizeNumber: %v is not a number", n)
+	}
+	l := c.findLocale(localeName)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	intPart, fracPart := s, ""
+	if i := strings.Index(s, "."); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+	var buf []byte
+	for i := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			buf = append(buf, l.group...)
+		}
+		buf = append(buf, intPart[i])
+	}
+	if fracPart != "" {
+		buf = append(buf, l.decimal...)
+		buf = append(buf, fracPart...)
+	}
+	return sign + string(buf), nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2013 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package layouts
+
+import (
+	"fmt"
+	"sort"
+)
+
+// MenuItem is an item of menu tree.
+type MenuItem struct {
+	Item     interface{}
+	Children []*MenuItem
+}
+
+type menuEntry struct {
+	id, parent string
+	weight     float64
+	item       interface{}
+}
+
+type byWeight []*menuEntry
+
+func (w byWeight) Len() int           { return len(w) }
+func (w byWeight) Less(i, j int) bool { return w[i].weight < w[j].weight }
+func (w byWeight) Swap(i, j int)      { w[i], w[j] = w[j], w[i] }
+
+// menuTree builds tree from items with `id`, `parent`, and `weight`
+// keys. Children are sorted by weight, keeping the original order of
+// items with equal weights. Items with unknown parent are attached
+// to the root.
+func menuTree(items interface{}) ([]*MenuItem, error) {
+	list, err := listOf(items)
+	if err != nil {
+		return nil, fmt.Errorf("menuTree: %s", err)
+	}
+	entries := make([]*menuEntry, len(list))
+	ids := make(map[string]bool)
+	for i, item := range list {
+		m, ok := stringMap(item)
+		if !ok {
+			if m, err = metaOf(item); err != nil {
+				return nil, fmt.Errorf("menuTree: %s", err)
+			}
+		}
+		e := &menuEntry{item: item}
+		if v, ok := m["id"]; ok && v != nil {
+			e.id = fmt.Sprint(v)
+		}
+		if v, ok := m["parent"]; ok && v != nil {
+			e.parent = fmt.Sprint(v)
+		}
+		if v, ok := m["weight"]; ok {
+			if e.weight, err = toFloat(v); err != nil {
+				return nil, fmt.Errorf("menuTree: weight: %s", err)
+			}
+		}
+		if e.id != "" {
+			ids[e.id] = true
+		}
+		entries[i] = e
+	}
+	sort.Stable(byWeight(entries))
+	children := make(map[string][]*menuEntry)
+	var roots []*menuEntry
+	for _, e := range entries {
+		if e.parent == "" || !ids[e.parent] || e.parent == e.id {
+			roots = append(roots, e)
+		} else {
+			children[e.parent] = append(children[e.parent], e)
+		}
+	}
+	added := make(map[*menuEntry]bool)
+	var build func(list []*menuEntry) []*MenuItem
+	build = func(list []*menuEntry) []*MenuItem {
+		var out []*MenuItem
+		for _, e := range list {
+			if added[e] {
+				continue
+			}
+			added[e] = true
+			mi := &MenuItem{Item: e.item}
+			if e.id != "" {
+				mi.Children = build(children[e.id])
+			}
+			out = append(out, mi)
+		}
+		return out
+	}
+	tree := build(roots)
+	// Attach items with cyclic parents to the root.
+	for _, e := range entries {
+		if !added[e] {
+			tree = append(tree, build([]*menuEntry{e})...)
+		}
+	}
+	return tree, nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2013 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package layouts
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// OutputFormat describes an output format of pages.
+type OutputFormat struct {
+	Type string // content type
+	Rel  string // relation used in links to this output
+	// URL pattern, where :url is replaced with page URL,
+	// e.g. "/amp:url" makes "/amp/about/" for "/about/",
+	// and :base with page URL without extension, or with
+	// "index" for directory URLs, e.g. ":base.json" makes
+	// "/about/index.json" for "/about/" and "/about.json"
+	// for "/about.html".
+	URL string
+}
+
+// DefaultOutputFormats are output formats known to collection.
+var DefaultOutputFormats = map[string]OutputFormat{
+	"html": {Type: "text/html", Rel: "canonical", URL: ":url"},
+	"amp":  {Type: "text/html", Rel: "amphtml", URL: "/amp:url"},
+	"json": {Type: "application/json", Rel: "alternate", URL: ":base.json"},
+}
+
+// outputURL returns URL made from pattern for page URL.
+func outputURL(pattern, url string) string {
+	base := url
+	if strings.HasSuffix(base, "/") {
+		base += "index"
+	} else {
+		base = strings.TrimSuffix(base, path.Ext(base))
+	}
+	return strings.NewReplacer(":url", url, ":base", base).Replace(pattern)
+}
+
+// SetOutputFormat sets output format with the given name
+// used by `outputLinks` template function.
+func (c *Collection) SetOutputFormat(name string, f OutputFormat) {
+	if c.outputFormats == nil {
+		c.outputFormats = make(map[string]OutputFormat)
+		for k, v := range DefaultOutputFormats {
+			c.outputFormats[k] = v
+		}
+	}
+	c.outputFormats[name] = f
+}
+
+func (c *Collection) outputFormat(name string) (OutputFormat, bool) {
+	if c.outputFormats == nil {
+		f, ok := DefaultOutputFormats[name]
+		return f, ok
+	}
+	f, ok := c.outputFormats[name]
+	return f, ok
+}
+
+// OutputLink is a link to page output.
+type OutputLink struct {
+	Format string
+	URL    string
+	Type   string
+	Rel    string
+}
+
+// outputLinks returns links to outputs of page listed in its
+// `outputs` meta, such as [html, amp].
+func (c *Collection) outputLinks(page interface{}) ([]OutputLink, error) {
+	meta, err := metaOf(page)
+	if err != nil {
+		return nil, fmt.Errorf("outputLinks: %s", err)
+	}
+	url, err := pageURL(page)
+	if err != nil {
+		return nil, fmt.Errorf("outputLinks: %s", err)
+	}
+	var names []string
+	switch v := meta["outputs"].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		names = strings.Split(v, ",")
+	case []string:
+		names = v
+	case []interface{}:
+		for _, x := range v {
+			names = append(names, fmt.Sprint(x))
+		}
+	default:
+		return nil, fmt.Errorf("outputLinks: `outputs` must be a list")
+	}
+	links := make([]OutputLink, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		f, ok := c.outputFormat(name)
+		if !ok {
+			return nil, fmt.Errorf("outputLinks: unknown output format %q", name)
+		}
+		links = append(links, OutputLink{
+			Format: name,
+			URL:    c.absURL(outputURL(f.URL, url)),
+			Type:   f.Type,
+			Rel:    f.Rel,
+		})
+	}
+	return links, nil
+}
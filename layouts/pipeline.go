@@ -0,0 +1,142 @@
+// Copyright 2013 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package layouts
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dchest/kkr/markup"
+)
+
+// Stage is a stage of page rendering pipeline.
+type Stage string
+
+const (
+	// TemplateStage executes page content as a template.
+	TemplateStage Stage = "template"
+	// MarkdownStage converts content from Markdown to HTML. Use it
+	// only for pages which content wasn't converted when loading.
+	MarkdownStage Stage = "markdown"
+	// SanitizeStage sanitizes content with the collection sanitizer.
+	SanitizeStage Stage = "sanitize"
+	// LayoutStage wraps content into page layout and its parents.
+	LayoutStage Stage = "layout"
+	// PostProcessStage adds draft watermark, applies typographer, adds
+	// heading anchors, rewrites asset URLs, runs post-processor for
+	// output extension, and handles final newline.
+	PostProcessStage Stage = "postprocess"
+)
+
+// DefaultPipeline is the default order of rendering stages.
+var DefaultPipeline = []Stage{TemplateStage, LayoutStage, PostProcessStage}
+
+// SetPipeline sets the order of stages used to render pages.
+func (c *Collection) SetPipeline(stages []Stage) error {
+	for _, s := range stages {
+		switch s {
+		case TemplateStage, MarkdownStage, SanitizeStage, LayoutStage, PostProcessStage:
+		default:
+			return fmt.Errorf("unknown rendering stage %q", s)
+		}
+	}
+	c.pipeline = stages
+	return nil
+}
+
+// runStage runs rendering stage on content of page,
+// which has the given layout, and returns the result.
+func (c *Collection) runStage(st *renderState, stage Stage, pageContext PageContext, layoutName, defaultLayoutName, content string) (string, error) {
+	switch stage {
+	case TemplateStage:
+		p, err := c.newLayout("", "none", content)
+		if err != nil {
+			return "", err
+		}
+		return c.renderLayout(st, p, pageContext, content)
+	case MarkdownStage:
+		b, err := markup.Process("markdown", []byte(content))
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	case SanitizeStage:
+		return c.sanitize(content), nil
+	case LayoutStage:
+		if layoutName == "" || layoutName == "none" {
+			return content, nil
+		}
+		l, ok := c.layouts[layoutName]
+		if !ok {
+			return "", fmt.Errorf("layout %q not found", layoutName)
+		}
+		return c.renderLayoutDepth(st, l, pageContext, content, 1)
+	case PostProcessStage:
+		return c.postProcess(pageContext, defaultLayoutName, content)
+	default:
+		return "", fmt.Errorf("unknown rendering stage %q", stage)
+	}
+}
+
+// postProcess adds draft watermark, applies typographer, adds heading
+// anchors, applies asset rewriter, post-processor, and final newline
+// policy to output.
+func (c *Collection) postProcess(pageContext PageContext, defaultLayoutName, out string) (string, error) {
+	if c.devMode && c.draftWatermark != "" && c.isHTML(pageContext, defaultLayoutName) {
+		if draft, _ := pageContext.Meta()["draft"].(bool); draft {
+			out = insertBeforeBodyEnd(out, c.draftWatermark)
+		}
+	}
+	if c.typographer != nil && c.isHTML(pageContext, defaultLayoutName) {
+		var err error
+		out, err = typeset(out, c.typographer)
+		if err != nil {
+			return "", err
+		}
+	}
+	if c.headingAnchors && c.isHTML(pageContext, defaultLayoutName) {
+		var err error
+		out, err = addHeadingAnchors(out)
+		if err != nil {
+			return "", err
+		}
+	}
+	if c.assetRewriter != nil && c.isHTML(pageContext, defaultLayoutName) {
+		var err error
+		out, err = rewriteURLs(out, func(url string) string {
+			if strings.HasPrefix(url, "/") && !strings.HasPrefix(url, "//") {
+				return c.assetRewriter(url)
+			}
+			return url
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	if f, ok := c.postProcessors[c.outputExt(pageContext, defaultLayoutName)]; ok {
+		b, err := f([]byte(out))
+		if err != nil {
+			return "", err
+		}
+		out = string(b)
+	}
+	switch c.finalNewline {
+	case AddFinalNewline:
+		out = strings.TrimRight(out, "\r\n") + "\n"
+	case StripFinalNewline:
+		out = strings.TrimRight(out, "\r\n")
+	}
+	return out, nil
+}
+
+// insertBeforeBodyEnd inserts s before the last </body> tag
+// in HTML or appends it if there's no such tag.
+func insertBeforeBodyEnd(html, s string) string {
+	i := strings.LastIndex(strings.ToLower(html), "</body>")
+	if i < 0 {
+		return html + s
+	}
+	return html[:i] + s + html[i:]
+}
@@ -0,0 +1,138 @@
+// Copyright 2013 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package layouts
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// renderRecord describes a rendered page and files it depends on.
+type renderRecord struct {
+	page              PageContext
+	defaultLayoutName string
+	layoutFiles       []string // source files of layouts in chain
+	includes          []string // names of used includes
+}
+
+// layoutChain returns names of layouts applied to page, starting with
+// the page's own layout and ending with the outermost one.
+func (c *Collection) layoutChain(pageContext PageContext, defaultLayoutName string) []string {
+	name, _ := c.layoutNameFromMeta(pageContext.Meta())
+	if name == "" {
+		name = c.defaultLayout(pageContext, defaultLayoutName)
+	}
+	var chain []string
+	seen := make(map[string]bool)
+	for name != "" && name != "none" && !seen[name] {
+		seen[name] = true
+		chain = append(chain, name)
+		l, ok := c.layouts[name]
+		if !ok {
+			break
+		}
+		name = c.parentName(l)
+	}
+	return chain
+}
+
+// record remembers rendered page, which used the given includes, for Rebuild.
+func (c *Collection) record(pageContext PageContext, defaultLayoutName string, includes []string) {
+	r := &renderRecord{
+		page:              pageContext,
+		defaultLayoutName: defaultLayoutName,
+		includes:          includes,
+	}
+	for _, name := range c.layoutChain(pageContext, defaultLayoutName) {
+		if l := c.layouts[name]; l != nil && l.Filename != "" {
+			r.layoutFiles = append(r.layoutFiles, filepath.Clean(l.Filename))
+		}
+	}
+	c.mu.Lock()
+	c.records[pageContext.URL()] = r
+	c.mu.Unlock()
+}
+
+// PagesUsingInclude returns URLs of rendered pages which used include.
+func (c *Collection) PagesUsingInclude(name string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var urls []string
+	for url, r := range c.records {
+		for _, v := range r.includes {
+			if v == name {
+				urls = append(urls, url)
+				break
+			}
+		}
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// Rebuild reloads changed layout files and renders again pages
+// previously rendered by RenderPage which depend on the changed layouts
+// or whose source files changed. It returns URLs of rendered pages.
+//
+// If a page resolver is set, pages with changed source files are
+// resolved again by their URLs to get the new content.
+func (c *Collection) Rebuild(changedFiles []string) (rerendered []string, err error) {
+	changed := make(map[string]bool)
+	for _, f := range changedFiles {
+		changed[filepath.Clean(f)] = true
+	}
+	// Reload changed layouts.
+	for _, l := range c.layouts {
+		if l.Filename != "" && changed[filepath.Clean(l.Filename)] {
+			c.clearWarnings(l.Filename)
+			if err := c.AddFile(l.Filename); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// Find affected pages.
+	c.mu.Lock()
+	urls := make([]string, 0)
+	records := make(map[string]*renderRecord)
+	for url, r := range c.records {
+		affected := changed[filepath.Clean(sourcePath(r.page))]
+		for _, f := range r.layoutFiles {
+			if changed[f] {
+				affected = true
+				break
+			}
+		}
+		if affected {
+			urls = append(urls, url)
+			records[url] = r
+		}
+	}
+	c.mu.Unlock()
+	sort.Strings(urls)
+	// Render them.
+	for _, url := range urls {
+		r := records[url]
+		page := r.page
+		if c.pageResolver != nil && changed[filepath.Clean(sourcePath(page))] {
+			if page, err = c.pageResolver(url); err != nil {
+				return rerendered, err
+			}
+		}
+		out, includes, err := c.render(page, r.defaultLayoutName)
+		if err != nil {
+			return rerendered, err
+		}
+		c.record(page, r.defaultLayoutName, includes)
+		if ok, _ := c.cacheable(page, r.defaultLayoutName); ok && renderedCache != nil {
+			tags, err := cacheTags(page.Meta())
+			if err != nil {
+				return rerendered, err
+			}
+			renderedCache.Put(url, page.FileInfo(), out, tags)
+		}
+		rerendered = append(rerendered, url)
+	}
+	return rerendered, nil
+}
@@ -0,0 +1,173 @@
+// Copyright 2013 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package layouts
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// semver is a parsed semantic version.
+type semver struct {
+	nums [3]int
+	pre  []string // pre-release identifiers
+}
+
+// parseSemver parses version, such as "v1.2.3-beta.1+build".
+// Minor and patch numbers may be omitted.
+func parseSemver(s string) (*semver, error) {
+	v := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.Index(v, "+"); i >= 0 {
+		v = v[:i] // ignore build metadata
+	}
+	var sv semver
+	if i := strings.Index(v, "-"); i >= 0 {
+		sv.pre = strings.Split(v[i+1:], ".")
+		for _, id := range sv.pre {
+			if id == "" {
+				return nil, fmt.Errorf("invalid version %q", s)
+			}
+		}
+		v = v[:i]
+	}
+	parts := strings.Split(v, ".")
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("invalid version %q", s)
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid version %q", s)
+		}
+		sv.nums[i] = n
+	}
+	return &sv, nil
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compare returns -1, 0, or 1 depending on whether
+// v is lower, equal, or higher than w.
+func (v *semver) compare(w *semver) int {
+	for i := range v.nums {
+		if c := compareInts(v.nums[i], w.nums[i]); c != 0 {
+			return c
+		}
+	}
+	// Release is higher than pre-release.
+	switch {
+	case len(v.pre) == 0 && len(w.pre) == 0:
+		return 0
+	case len(v.pre) == 0:
+		return 1
+	case len(w.pre) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.pre) && i < len(w.pre); i++ {
+		a, errA := strconv.Atoi(v.pre[i])
+		b, errB := strconv.Atoi(w.pre[i])
+		switch {
+		case errA == nil && errB == nil:
+			if c := compareInts(a, b); c != 0 {
+				return c
+			}
+		case errA == nil:
+			return -1 // numeric identifiers are lower
+		case errB == nil:
+			return 1
+		default:
+			if c := strings.Compare(v.pre[i], w.pre[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return compareInts(len(v.pre), len(w.pre))
+}
+
+// SetStrictSemver sets whether semver template functions return
+// an error for invalid versions. By default, invalid versions are
+// considered lower than valid ones, so that they sort last in
+// `semverSort` and are never chosen by `semverLatest`.
+func (c *Collection) SetStrictSemver(strict bool) {
+	c.strictSemver = strict
+}
+
+func (c *Collection) semverCompare(a, b string) (int, error) {
+	v, errA := parseSemver(a)
+	w, errB := parseSemver(b)
+	if c.strictSemver {
+		if errA != nil {
+			return 0, errA
+		}
+		if errB != nil {
+			return 0, errB
+		}
+	}
+	switch {
+	case errA != nil && errB != nil:
+		return strings.Compare(a, b), nil
+	case errA != nil:
+		return -1, nil
+	case errB != nil:
+		return 1, nil
+	}
+	return v.compare(w), nil
+}
+
+// semverSort returns versions sorted from the highest to the lowest.
+func (c *Collection) semverSort(list interface{}) ([]string, error) {
+	items, err := listOf(list)
+	if err != nil {
+		return nil, fmt.Errorf("semverSort: %s", err)
+	}
+	versions := make([]string, len(items))
+	for i, v := range items {
+		versions[i] = fmt.Sprint(v)
+		if c.strictSemver {
+			if _, err := parseSemver(versions[i]); err != nil {
+				return nil, fmt.Errorf("semverSort: %s", err)
+			}
+		}
+	}
+	sort.Stable(semverDesc{c, versions})
+	return versions, nil
+}
+
+type semverDesc struct {
+	c        *Collection
+	versions []string
+}
+
+func (s semverDesc) Len() int      { return len(s.versions) }
+func (s semverDesc) Swap(i, j int) { s.versions[i], s.versions[j] = s.versions[j], s.versions[i] }
+func (s semverDesc) Less(i, j int) bool {
+	n, _ := s.c.semverCompare(s.versions[i], s.versions[j])
+	return n > 0
+}
+
+// semverLatest returns the highest valid version, or empty string.
+func (c *Collection) semverLatest(list interface{}) (string, error) {
+	versions, err := c.semverSort(list)
+	if err != nil {
+		return "", err
+	}
+	if len(versions) == 0 {
+		return "", nil
+	}
+	if _, err := parseSemver(versions[0]); err != nil {
+		return "", nil
+	}
+	return versions[0], nil
+}
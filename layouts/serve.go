@@ -0,0 +1,52 @@
+// Copyright 2013 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package layouts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ETag returns strong entity tag made from hash of content.
+func ETag(content string) string {
+	h := sha256.Sum256([]byte(content))
+	return `"` + hex.EncodeToString(h[:16]) + `"`
+}
+
+// etagMatches reports whether If-None-Match header value matches etag.
+func etagMatches(header, etag string) bool {
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.TrimPrefix(v, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ServePage renders page and writes it to w with Content-Type and ETag
+// headers. If request's If-None-Match header matches the ETag, it
+// responds with 304 Not Modified without body.
+func (c *Collection) ServePage(w http.ResponseWriter, r *http.Request, pageContext PageContext, defaultLayoutName string) error {
+	res, err := c.RenderPageResult(pageContext, defaultLayoutName)
+	if err != nil {
+		return err
+	}
+	etag := ETag(res.Output)
+	w.Header().Set("ETag", etag)
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	w.Header().Set("Content-Type", res.ContentType)
+	if r.Method == "HEAD" {
+		return nil
+	}
+	_, err = io.WriteString(w, res.Output)
+	return err
+}
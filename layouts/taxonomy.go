@@ -0,0 +1,179 @@
+// Copyright 2013 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package layouts
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// hasTerm reports whether page meta has value in the given taxonomy,
+// which can be a string, a comma-separated list, or a list of strings.
+func hasTerm(meta map[string]interface{}, taxonomy, value string) bool {
+	switch t := meta[taxonomy].(type) {
+	case string:
+		for _, s := range strings.Split(t, ",") {
+			if strings.TrimSpace(s) == value {
+				return true
+			}
+		}
+	case []string:
+		for _, s := range t {
+			if s == value {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, s := range t {
+			if fmt.Sprint(s) == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// inTaxonomy returns pages having value in taxonomy sorted by date,
+// oldest first, and the index of page among them.
+func inTaxonomy(page, allPages interface{}, taxonomy, value string) ([]interface{}, int, error) {
+	url, err := pageURL(page)
+	if err != nil {
+		return nil, -1, err
+	}
+	list, err := listOf(allPages)
+	if err != nil {
+		return nil, -1, err
+	}
+	var dated []datedPage
+	for _, p := range list {
+		meta, err := metaOf(p)
+		if err != nil {
+			return nil, -1, err
+		}
+		if !hasTerm(meta, taxonomy, value) {
+			continue
+		}
+		date, _, err := metaDate(meta, "date")
+		if err != nil {
+			return nil, -1, err
+		}
+		dated = append(dated, datedPage{date, p})
+	}
+	sort.Stable(sort.Reverse(byDateDesc(dated)))
+	pages := make([]interface{}, len(dated))
+	index := -1
+	for i, d := range dated {
+		pages[i] = d.page
+		if u, err := pageURL(d.page); err == nil && u == url {
+			index = i
+		}
+	}
+	return pages, index, nil
+}
+
+// prevInTaxonomy returns page published before the given page
+// among pages with the same taxonomy value, or nil.
+func prevInTaxonomy(page, allPages interface{}, taxonomy, value string) (interface{}, error) {
+	pages, i, err := inTaxonomy(page, allPages, taxonomy, value)
+	if err != nil || i <= 0 {
+		return nil, err
+	}
+	return pages[i-1], nil
+}
+
+// nextInTaxonomy returns page published after the given page
+// among pages with the same taxonomy value, or nil.
+func nextInTaxonomy(page, allPages interface{}, taxonomy, value string) (interface{}, error) {
+	pages, i, err := inTaxonomy(page, allPages, taxonomy, value)
+	if err != nil || i < 0 || i >= len(pages)-1 {
+		return nil, err
+	}
+	return pages[i+1], nil
+}
+
+// SeriesNav describes position of page in series.
+type SeriesNav struct {
+	Series string
+	Parts  []interface{} // pages of series in order
+	Index  int           // index of page in Parts
+	Number int           // 1-based part number of page
+	Total  int
+	Prev   interface{} // previous part, or nil
+	Next   interface{} // next part, or nil
+}
+
+type seriesPart struct {
+	order float64
+	page  interface{}
+}
+
+type bySeriesOrder []seriesPart
+
+func (s bySeriesOrder) Len() int           { return len(s) }
+func (s bySeriesOrder) Less(i, j int) bool { return s[i].order < s[j].order }
+func (s bySeriesOrder) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// seriesNav returns navigation in series, which page belongs to
+// according to its `series` meta, with parts ordered by `series_order`.
+// It returns nil for pages without series.
+func seriesNav(page, allPages interface{}) (*SeriesNav, error) {
+	meta, err := metaOf(page)
+	if err != nil {
+		return nil, err
+	}
+	series, err := stringFromMeta(meta, "series")
+	if err != nil || series == "" {
+		return nil, err
+	}
+	url, err := pageURL(page)
+	if err != nil {
+		return nil, err
+	}
+	list, err := listOf(allPages)
+	if err != nil {
+		return nil, err
+	}
+	var parts []seriesPart
+	for _, p := range list {
+		m, err := metaOf(p)
+		if err != nil {
+			return nil, err
+		}
+		if s, _ := m["series"].(string); s != series {
+			continue
+		}
+		var order float64
+		if v, ok := m["series_order"]; ok {
+			if order, err = toFloat(v); err != nil {
+				return nil, fmt.Errorf("series_order: %s", err)
+			}
+		}
+		parts = append(parts, seriesPart{order, p})
+	}
+	sort.Stable(bySeriesOrder(parts))
+	nav := &SeriesNav{
+		Series: series,
+		Parts:  make([]interface{}, len(parts)),
+		Index:  -1,
+		Total:  len(parts),
+	}
+	for i, p := range parts {
+		nav.Parts[i] = p.page
+		if u, err := pageURL(p.page); err == nil && u == url {
+			nav.Index = i
+		}
+	}
+	if nav.Index >= 0 {
+		nav.Number = nav.Index + 1
+		if nav.Index > 0 {
+			nav.Prev = nav.Parts[nav.Index-1]
+		}
+		if nav.Index < len(nav.Parts)-1 {
+			nav.Next = nav.Parts[nav.Index+1]
+		}
+	}
+	return nav, nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2013 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package layouts
+
+import (
+	"fmt"
+	"sort"
+	"text/template"
+	"text/template/parse"
+)
+
+// Categories of warnings.
+const (
+	DeprecatedWarning = "deprecated" // use of deprecated function
+	SkippedWarning    = "skipped"    // file skipped when loading
+	BrokenLinkWarning = "brokenlink" // link to unknown internal URL
+)
+
+// Warning is a non-fatal issue found when loading layouts
+// or rendering pages.
+type Warning struct {
+	Category string
+	Message  string
+	Filename string // source file
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s: %s: %s", w.Filename, w.Category, w.Message)
+}
+
+// Warnings returns warnings collected when loading layouts
+// and rendering pages.
+func (c *Collection) Warnings() []Warning {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Warning(nil), c.warnings...)
+}
+
+func (c *Collection) warn(category, filename, format string, args ...interface{}) {
+	w := Warning{
+		Category: category,
+		Message:  fmt.Sprintf(format, args...),
+		Filename: filename,
+	}
+	c.mu.Lock()
+	c.warnings = append(c.warnings, w)
+	c.mu.Unlock()
+}
+
+// clearWarnings removes warnings for the given file.
+func (c *Collection) clearWarnings(filename string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	kept := c.warnings[:0]
+	for _, w := range c.warnings {
+		if w.Filename != filename {
+			kept = append(kept, w)
+		}
+	}
+	c.warnings = kept
+}
+
+// SetDeprecatedFuncs sets template functions, which produce warnings
+// when used in loaded layouts, mapped to messages describing what
+// to use instead.
+func (c *Collection) SetDeprecatedFuncs(funcs map[string]string) {
+	c.deprecatedFuncs = funcs
+}
+
+// checkDeprecated records warnings for deprecated functions used in template.
+func (c *Collection) checkDeprecated(t *template.Template, filename string) {
+	if len(c.deprecatedFuncs) == 0 {
+		return
+	}
+	used := make(map[string]bool)
+	for _, x := range t.Templates() {
+		if x.Tree != nil {
+			collectIdentifiers(x.Tree.Root, used)
+		}
+	}
+	names := make([]string, 0, len(used))
+	for name := range used {
+		if _, ok := c.deprecatedFuncs[name]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c.warn(DeprecatedWarning, filename, "function %q is deprecated: %s", name, c.deprecatedFuncs[name])
+	}
+}
+
+// collectIdentifiers adds names of functions used in node to m.
+func collectIdentifiers(node parse.Node, m map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, x := range n.Nodes {
+			collectIdentifiers(x, m)
+		}
+	case *parse.ActionNode:
+		collectIdentifiers(n.Pipe, m)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			collectIdentifiers(cmd, m)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			collectIdentifiers(arg, m)
+		}
+	case *parse.ChainNode:
+		collectIdentifiers(n.Node, m)
+	case *parse.IdentifierNode:
+		m[n.Ident] = true
+	case *parse.IfNode:
+		collectIdentifiers(&n.BranchNode, m)
+	case *parse.RangeNode:
+		collectIdentifiers(&n.BranchNode, m)
+	case *parse.WithNode:
+		collectIdentifiers(&n.BranchNode, m)
+	case *parse.BranchNode:
+		collectIdentifiers(n.Pipe, m)
+		collectIdentifiers(n.List, m)
+		collectIdentifiers(n.ElseList, m)
+	case *parse.TemplateNode:
+		collectIdentifiers(n.Pipe, m)
+	}
+}
@@ -83,6 +83,7 @@ func main() {
 		}
 	}
 	currentSite.SetCleanBeforeBuilding(!*fNoClean)
+	currentSite.SetDevMode(*fWatch || command == "serve")
 
 	switch command {
 	case "build":
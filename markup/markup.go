@@ -34,7 +34,7 @@ func processMarkdown(content []byte) ([]byte, error) {
 		blackfriday.HTML_SMARTYPANTS_DASHES |
 		blackfriday.HTML_SMARTYPANTS_LATEX_DASHES
 
-	if options.MarkdownAngledQuotes {
+	if options != nil && options.MarkdownAngledQuotes {
 		htmlFlags |= blackfriday.HTML_SMARTYPANTS_ANGLED_QUOTES
 	}
 
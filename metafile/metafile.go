@@ -8,7 +8,6 @@ package metafile
 import (
 	"bufio"
 	"bytes"
-	"errors"
 	"io"
 	"os"
 	"strings"
@@ -19,6 +18,31 @@ import (
 
 const metaSeparator = "---"
 
+// Separators opening and closing the meta header.
+var (
+	openSeparator  = metaSeparator
+	closeSeparator = metaSeparator
+)
+
+// SetDelimiter sets separators that open and close the meta header.
+// Each separator must be on its own line. Empty strings reset the
+// corresponding separator to the default "---".
+func SetDelimiter(open, close string) {
+	if open == "" {
+		open = metaSeparator
+	}
+	if close == "" {
+		close = metaSeparator
+	}
+	openSeparator = open
+	closeSeparator = close
+}
+
+// Delimiter returns separators that open and close the meta header.
+func Delimiter() (open, close string) {
+	return openSeparator, closeSeparator
+}
+
 type File struct {
 	sync.Mutex
 	fi          os.FileInfo
@@ -55,9 +79,26 @@ func Open(name string) (m *File, err error) {
 	return m, nil
 }
 
+// NewReader returns a File reading from r, which is described by fi.
+// Closing the returned File doesn't close r.
+func NewReader(r io.Reader, fi os.FileInfo) (m *File, err error) {
+	m = &File{
+		fi: fi,
+		r:  bufio.NewReader(r),
+	}
+	// Try reading meta.
+	if err := m.readMeta(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (m *File) Close() error {
 	m.Lock()
 	defer m.Unlock()
+	if m.f == nil {
+		return nil
+	}
 	return m.f.Close()
 }
 
@@ -69,26 +110,21 @@ func (m *File) readMeta() error {
 		return nil
 	}
 	// Check if we have a meta file.
-	p, err := m.r.Peek(len(metaSeparator) + 1)
-	if (err != nil && err == io.EOF) || strings.TrimSpace(string(p)) != metaSeparator {
+	line, err := m.peekLine()
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if err == io.EOF || strings.TrimSpace(line) != openSeparator {
 		m.metaRead = true
 		m.hasMeta = false
 		return nil
 	}
-	if err != nil {
-		return err
-	}
 
 	// Read meta.
 	// Skip starting separator
-	head, err := m.r.ReadString('\n')
-	if err != nil {
+	if _, err := m.r.ReadString('\n'); err != nil {
 		return err
 	}
-	if strings.TrimSpace(head) != metaSeparator {
-		// Bad separator.
-		return errors.New("Bad meta separator on the first line")
-	}
 	buf := bytes.NewBuffer(nil)
 	for {
 		var s string
@@ -96,7 +132,7 @@ func (m *File) readMeta() error {
 		if err != nil {
 			return err
 		}
-		if len(s) > 0 && strings.TrimSpace(s) == metaSeparator {
+		if len(s) > 0 && strings.TrimSpace(s) == closeSeparator {
 			break
 		}
 		buf.WriteString(s)
@@ -110,6 +146,24 @@ func (m *File) readMeta() error {
 	return nil
 }
 
+// peekLine returns the first line including newline without advancing
+// the reader. It returns io.EOF if there's no newline in the input.
+// Lines longer than the reader's buffer are truncated.
+func (m *File) peekLine() (string, error) {
+	for n := 64; ; n *= 2 {
+		p, err := m.r.Peek(n)
+		if i := bytes.IndexByte(p, '\n'); i >= 0 {
+			return string(p[:i+1]), nil
+		}
+		if err == bufio.ErrBufferFull {
+			return string(p), nil
+		}
+		if err != nil {
+			return string(p), err
+		}
+	}
+}
+
 func (m *File) Content() ([]byte, error) {
 	m.Lock()
 	defer m.Unlock()
@@ -9,6 +9,7 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -96,3 +97,70 @@ func TestNoMeta(t *testing.T) {
 		t.Errorf("content differs: expecting `%s`, got `%s`", metaContent, content)
 	}
 }
+
+func TestCustomDelimiter(t *testing.T) {
+	SetDelimiter("<!--", "-->")
+	defer SetDelimiter("", "")
+
+	filename, err := WriteTempFile("<!--\n" + metaKey + ": " + metaValue + "\n-->\n" + metaContent)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.Remove(filename)
+
+	m, err := Open(filename)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer m.Close()
+	if !m.HasMeta() {
+		t.Errorf("HasMeta returned false, expecting true")
+	}
+	v, ok := m.Meta()[metaKey]
+	if !ok || v.(string) != metaValue {
+		t.Errorf("expecting %q: %q, got %q", metaKey, metaValue, v)
+	}
+	content, err := m.Content()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if !bytes.Equal(content, []byte(metaContent)) {
+		t.Errorf("content differs: expecting `%s`, got `%s`", metaContent, content)
+	}
+
+	// Ordinary comment on the first line is not a meta header.
+	for _, text := range []string{"<!-- foo -->\n" + metaContent, "<!--foo\n-->\n" + metaContent, "<!-- foo -->"} {
+		m, err := NewReader(strings.NewReader(text), nil)
+		if err != nil {
+			t.Fatalf("%q: %s", text, err)
+		}
+		if m.HasMeta() {
+			t.Errorf("%q: HasMeta returned true, expecting false", text)
+		}
+		content, err := m.Content()
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if string(content) != text {
+			t.Errorf("content differs: expecting `%s`, got `%s`", text, content)
+		}
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	m, err := NewReader(strings.NewReader(fileWithMeta), nil)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer m.Close()
+	if v, _ := m.Meta()[metaKey].(string); v != metaValue {
+		t.Errorf("expecting %q: %q, got %q", metaKey, metaValue, v)
+	}
+	content, err := m.Content()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if !bytes.Equal(content, []byte(metaContent)) {
+		t.Errorf("content differs: expecting `%s`, got `%s`", metaContent, content)
+	}
+}
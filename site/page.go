@@ -11,6 +11,7 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/dchest/kkr/layouts"
 	"github.com/dchest/kkr/markup"
 	"github.com/dchest/kkr/metafile"
 	"github.com/dchest/kkr/utils"
@@ -54,12 +55,15 @@ type Page struct {
 	Basedir      string
 	Filename     string
 	url          string
+	source       string
 }
 
 func (p *Page) Meta() map[string]interface{} { return p.meta }
 func (p *Page) Content() string              { return p.content }
 func (p *Page) FileInfo() os.FileInfo        { return p.fi }
 func (p *Page) URL() string                  { return p.url }
+func (p *Page) SourcePath() string           { return p.source }
+func (p *Page) Summary() string              { return p.ShortContent }
 
 var NotPageError = errors.New("not a page or post")
 
@@ -67,7 +71,7 @@ func IsNotPage(err error) bool {
 	return err == NotPageError
 }
 
-const moreSeparator = "<!--more-->"
+const moreSeparator = layouts.MoreSeparator
 
 func extractShortContent(s string) (shortContent, content string) {
 	i := strings.Index(s, moreSeparator)
@@ -135,7 +139,6 @@ func LoadPage(basedir, filename string) (p *Page, err error) {
 
 	url := utils.CleanPermalink(filepath.ToSlash(filename))
 	meta["url"] = url
-	meta["id"] = filepath.ToSlash(filename)
 
 	shortContent, contentStr := extractShortContent(string(content))
 
@@ -147,6 +150,7 @@ func LoadPage(basedir, filename string) (p *Page, err error) {
 		Basedir:      basedir,
 		Filename:     filename,
 		url:          url,
+		source:       fullname,
 	}
 	if pageCache != nil {
 		// Cache this page
@@ -57,6 +57,7 @@ type Config struct {
 	Author      string                 `yaml:"author"`
 	Permalink   string                 `yaml:"permalink"`
 	URL         string                 `yaml:"url"`
+	Lang        string                 `yaml:"lang"`
 	Filters     map[string]interface{} `yaml:"filters"`
 	Properties  map[string]interface{} `yaml:"properties"`
 	SearchIndex string                 `yaml:"search_index"`
@@ -101,8 +102,12 @@ type Site struct {
 	buildQueue  chan bool
 	buildErrors chan error
 
+	pages []*Page  // loaded pages
+	files []string // names of files in pages directory which are not pages
+
 	watcher             *fspoll.Watcher
 	cleanBeforeBuilding bool
+	devMode             bool
 }
 
 func Open(dir string) (s *Site, err error) {
@@ -163,6 +168,16 @@ func (s *Site) LoadPageFilters() error {
 func (s *Site) LoadLayouts() (err error) {
 	log.Printf("* Loading layouts.")
 	s.Layouts = layouts.NewCollection(s)
+	s.Layouts.SetBaseURL(s.Config.URL)
+	s.Layouts.SetPageResolver(s.findPost)
+	s.Layouts.SetDevMode(s.devMode)
+	s.Layouts.SetDevMissingPartialPlaceholder(s.devMode)
+	if s.Config.Lang != "" {
+		s.Layouts.SetDefaultLocale(s.Config.Lang)
+	}
+	for name, content := range s.Includes {
+		s.Layouts.AddInclude(name, content)
+	}
 	return s.Layouts.AddDir(filepath.Join(s.BaseDir, LayoutsDirName))
 }
 
@@ -260,6 +275,16 @@ func (s *Site) LoadPosts() (err error) {
 	return nil
 }
 
+// findPost returns post with the given URL.
+func (s *Site) findPost(url string) (layouts.PageContext, error) {
+	for _, p := range s.Config.Posts {
+		if p.URL() == url {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("post %q not found", url)
+}
+
 func (s *Site) RenderPost(p *Post) error {
 	// Render post.
 	data, err := s.Layouts.RenderPage(p, DefaultPostLayout)
@@ -296,6 +321,10 @@ func (s *Site) RenderPage(pagesDir, relname string) error {
 		}
 		return err
 	}
+	return s.renderPage(p)
+}
+
+func (s *Site) renderPage(p *Page) error {
 	// Render page.
 	data, err := s.Layouts.RenderPage(p, DefaultPageLayout)
 	if err != nil {
@@ -311,10 +340,13 @@ func (s *Site) RenderPage(pagesDir, relname string) error {
 	return utils.WriteStringToFile(filepath.Join(s.BaseDir, OutDirName, p.Filename), data)
 }
 
-func (s *Site) RenderPages() error {
-	log.Printf("* Rendering pages")
+// LoadPages loads pages from pages directory and
+// remembers other files in it to copy them when rendering.
+func (s *Site) LoadPages() error {
+	log.Printf("* Loading pages.")
 	inDir := filepath.Join(s.BaseDir, PagesDirName)
-	return filepath.Walk(inDir, func(path string, fi os.FileInfo, err error) error {
+	s.pages, s.files = nil, nil
+	err := filepath.Walk(inDir, func(path string, fi os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -328,8 +360,58 @@ func (s *Site) RenderPages() error {
 		if s.isIgnoredFile(filepath.Base(relname)) {
 			return nil // skip ignored files
 		}
-		return s.RenderPage(inDir, relname)
+		log.Printf("P < %s\n", relname)
+		p, err := LoadPage(inDir, relname)
+		if err != nil {
+			if IsNotPage(err) {
+				s.files = append(s.files, relname)
+				return nil
+			}
+			return err
+		}
+		s.pages = append(s.pages, p)
+		return nil
 	})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// RenderPages renders pages and copies other files
+// loaded from pages directory by LoadPages.
+func (s *Site) RenderPages() error {
+	log.Printf("* Rendering pages")
+	for _, name := range s.files {
+		if err := s.CopyFile(name); err != nil {
+			return err
+		}
+	}
+	for _, p := range s.pages {
+		if err := s.renderPage(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// siteStats returns statistics of loaded posts and
+// pages available to templates as .Site.Stats.
+func (s *Site) siteStats() map[string]interface{} {
+	count, words := 0, 0
+	for _, p := range s.Config.Posts {
+		count++
+		words += layouts.CountWords(p.Content())
+	}
+	for _, p := range s.pages {
+		count++
+		words += layouts.CountWords(p.Content())
+	}
+	return map[string]interface{}{
+		"pageCount":  count,
+		"totalWords": words,
+		"lastBuild":  s.Config.Date,
+	}
 }
 
 func (s *Site) CopyFile(filename string) error {
@@ -413,6 +495,13 @@ func (s *Site) runBuild() (err error) {
 	if err != nil {
 		return
 	}
+	// Load pages.
+	err = s.LoadPages()
+	if err != nil {
+		return
+	}
+	// Set site stats.
+	s.Layouts.SetSiteStats(s.siteStats())
 	err = s.RenderPosts()
 	if err != nil {
 		return
@@ -497,8 +586,29 @@ func (s *Site) Clean() error {
 	return os.RemoveAll(filepath.Join(s.BaseDir, OutDirName))
 }
 
+// layoutData is site data available to templates as .Site.
+type layoutData struct {
+	*Config
+	Lang    string                 // site language or the default locale
+	BuildID string                 // build identifier
+	VCS     map[string]interface{} // version control information, if set
+	Stats   map[string]interface{} // site statistics
+	Debug   map[string]interface{} // effective options, if exposed
+}
+
 func (s *Site) LayoutData() interface{} {
-	return *s.Config
+	d := layoutData{
+		Config:  s.Config,
+		Lang:    s.Config.Lang,
+		BuildID: s.Layouts.BuildID(),
+		VCS:     s.Layouts.VCS(),
+		Stats:   s.Layouts.SiteStats(),
+		Debug:   s.Layouts.DebugInfo(),
+	}
+	if d.Lang == "" {
+		d.Lang = layouts.DefaultLocale
+	}
+	return d
 }
 
 func (s *Site) LayoutFuncs() layouts.FuncMap {
@@ -520,14 +630,6 @@ func (s *Site) LayoutFuncs() layouts.FuncMap {
 			}
 			return a.Result, nil
 		},
-		// `include` function returns text from include file.
-		"include": func(name string) (string, error) {
-			out, ok := s.Includes[name]
-			if !ok {
-				return "", fmt.Errorf("include %q not found", name)
-			}
-			return out, nil
-		},
 		// `abspaths` adds site URL to relative paths of src and href attributes.
 		"abspaths": func(in string) (string, error) {
 			return utils.AbsPaths(s.Config.URL, in), nil
@@ -596,3 +698,9 @@ func (s *Site) StopWatching() {
 func (s *Site) SetCleanBeforeBuilding(clean bool) {
 	s.cleanBeforeBuilding = clean
 }
+
+// SetDevMode sets development mode, in which missing
+// includes are rendered as placeholder comments.
+func (s *Site) SetDevMode(dev bool) {
+	s.devMode = dev
+}
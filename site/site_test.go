@@ -0,0 +1,151 @@
+// Copyright 2013 Dmitry Chestnykh. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package site
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dchest/kkr/layouts"
+)
+
+func newTestSite(conf *Config) *Site {
+	s := &Site{Config: conf}
+	s.Layouts = layouts.NewCollection(s)
+	return s
+}
+
+func renderString(t *testing.T, s *Site, content string) string {
+	out, err := s.Layouts.RenderPage(&Page{meta: map[string]interface{}{}, content: content}, "none")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	return out
+}
+
+func TestSiteStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "site-test-")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"index.html":  "---\ntitle: Home\n---\n<p>Welcome home</p>",
+		"about.html":  "---\ntitle: About\n---\nAbout this site",
+		"robots.txt":  "User-agent: *",
+		"about.html~": "---\ntitle: Backup\n---\nignored",
+	}
+	if err := os.Mkdir(filepath.Join(dir, PagesDirName), 0755); err != nil {
+		t.Fatalf("%s", err)
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, PagesDirName, name), []byte(content), 0644); err != nil {
+			t.Fatalf("%s", err)
+		}
+	}
+	s := newTestSite(&Config{
+		Date:  time.Date(2016, 1, 2, 0, 0, 0, 0, time.UTC),
+		Posts: Posts{{Page: Page{content: "<p>One two three four</p>"}}},
+	})
+	s.BaseDir = dir
+	if err := s.LoadPages(); err != nil {
+		t.Fatalf("%s", err)
+	}
+	s.Layouts.SetSiteStats(s.siteStats())
+	out := renderString(t, s, `{{.Site.Stats.pageCount}} {{.Site.Stats.totalWords}} {{.Site.Stats.lastBuild.Year}}`)
+	if exp := "3 9 2016"; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+}
+
+func TestLayoutData(t *testing.T) {
+	s := newTestSite(&Config{
+		Name: "Example",
+		Tags: map[string]Posts{"go": make(Posts, 2)},
+	})
+	if out := renderString(t, s, `{{.Site.Name}} {{len (.Site.PostsByTag "go")}}`); out != "Example 2" {
+		t.Errorf("expected %q, got %q", "Example 2", out)
+	}
+	// Values from layouts.
+	s.Layouts.SetVCSInfo(layouts.VCSInfo{Commit: "abc123"})
+	s.Layouts.SetExposeDebugConfig(true)
+	s.Layouts.SetBuildID("build-1")
+	s.Layouts.SetSiteStats(map[string]interface{}{"pageCount": 3})
+	out := renderString(t, s, `{{.Site.Name}} {{.Site.VCS.commit}} {{.Site.Debug.config.engine}} {{.Site.BuildID}} {{.Site.Stats.pageCount}}`)
+	if exp := "Example abc123 text/template build-1 3"; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+	// Unknown fields are errors.
+	if _, err := s.Layouts.RenderPage(&Page{meta: map[string]interface{}{}, content: `{{.Site.Nmae}}`}, "none"); err == nil {
+		t.Errorf("expected error for unknown field")
+	}
+}
+
+func TestLang(t *testing.T) {
+	s := newTestSite(&Config{})
+	if out := renderString(t, s, `{{.Site.Lang}} {{.Page.lang}}`); out != "en en" {
+		t.Errorf("expected %q, got %q", "en en", out)
+	}
+	s = newTestSite(&Config{Lang: "fr"})
+	s.Layouts.SetDefaultLocale(s.Config.Lang)
+	if out := renderString(t, s, `{{.Site.Lang}} {{.Page.lang}}`); out != "fr fr" {
+		t.Errorf("expected %q, got %q", "fr fr", out)
+	}
+}
+
+func TestPageID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "site-test-")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+	s := newTestSite(&Config{})
+	render := func(permalink string) (url, out string) {
+		content := "---\npermalink: " + permalink + "\n---\n{{.Page.id}} {{pageID .Page}}"
+		if err := ioutil.WriteFile(filepath.Join(dir, "page.html"), []byte(content), 0644); err != nil {
+			t.Fatalf("%s", err)
+		}
+		p, err := LoadPage(dir, "page.html")
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		out, err = s.Layouts.RenderPage(p, "none")
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		return p.URL(), out
+	}
+	url1, out1 := render("/one/")
+	url2, out2 := render("/two/")
+	if url1 == url2 {
+		t.Fatalf("expected different URLs, got %q", url1)
+	}
+	if out1 != out2 {
+		t.Errorf("id changed with URL: %q and %q", out1, out2)
+	}
+	if f := strings.Fields(out1); len(f) != 2 || f[0] != f[1] || f[0] == "" {
+		t.Errorf(".Page.id and pageID differ: %q", out1)
+	}
+}
+
+func TestSummaryOf(t *testing.T) {
+	s := newTestSite(&Config{})
+	short, content := extractShortContent("<p>Intro</p><!--more--><p>Rest</p>")
+	p := &Page{meta: map[string]interface{}{}, ShortContent: short, content: content}
+	out, err := s.Layouts.RenderPage(&Page{
+		meta:    map[string]interface{}{"post": p},
+		content: `{{summaryOf .Page.post}}`,
+	}, "none")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if exp := "<p>Intro</p>"; out != exp {
+		t.Errorf("expected %q, got %q", exp, out)
+	}
+}